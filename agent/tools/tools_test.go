@@ -5,9 +5,13 @@ package tools_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 
@@ -148,6 +152,73 @@ func (t *ToolsSuite) TestUnpackToolsContents(c *gc.C) {
 	t.assertToolsContents(c, testTools, files)
 }
 
+// tarXZ returns an xz-compressed tar archive holding the given files,
+// and its SHA256 checksum.
+func tarXZ(c *gc.C, files ...*testing.TarFile) ([]byte, string) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		c.Skip("xz not available")
+	}
+	data, _ := testing.TarGz(files...)
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	cmd := exec.Command("xz", "--compress", "--stdout")
+	cmd.Stdin = zr
+	out, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	return out, fmt.Sprintf("%x", sha256.Sum256(out))
+}
+
+func (t *ToolsSuite) TestUnpackToolsContentsXZ(c *gc.C) {
+	files := []*testing.TarFile{
+		testing.NewTarFile("bar", agenttools.DirPerm, "bar contents"),
+		testing.NewTarFile("foo", agenttools.DirPerm, "foo contents"),
+	}
+	data, checksum := tarXZ(c, files...)
+	testTools := &coretest.Tools{
+		URL:     "http://foo/bar",
+		Version: version.MustParseBinary("1.2.3-quantal-amd64"),
+		Size:    int64(len(data)),
+		SHA256:  checksum,
+	}
+
+	err := agenttools.UnpackTools(t.dataDir, testTools, bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	assertDirNames(c, t.toolsDir(), []string{"1.2.3-quantal-amd64"})
+	t.assertToolsContents(c, testTools, files)
+}
+
+func (t *ToolsSuite) TestUnpackToolsBadXZ(c *gc.C) {
+	data, _ := tarXZ(c, testing.NewTarFile("tools", agenttools.DirPerm, "some data"))
+	data = data[:len(data)/2]
+	testTools := &coretest.Tools{
+		URL:     "http://foo/bar",
+		Version: version.MustParseBinary("1.2.3-quantal-amd64"),
+		Size:    int64(len(data)),
+		SHA256:  fmt.Sprintf("%x", sha256.Sum256(data)),
+	}
+	err := agenttools.UnpackTools(t.dataDir, testTools, bytes.NewReader(data))
+	c.Assert(err, gc.ErrorMatches, "xz decompression failed: .*")
+	_, err = os.Stat(t.toolsDir())
+	c.Assert(err, gc.FitsTypeOf, &os.PathError{})
+}
+
+func (t *ToolsSuite) TestUnpackToolsXZWithoutXZCommand(c *gc.C) {
+	// Only the xz magic bytes are needed to select xz decompression.
+	data := []byte("\xfd7zXZ\x00 not really xz")
+	testTools := &coretest.Tools{
+		URL:     "http://foo/bar",
+		Version: version.MustParseBinary("1.2.3-quantal-amd64"),
+		Size:    int64(len(data)),
+		SHA256:  fmt.Sprintf("%x", sha256.Sum256(data)),
+	}
+	t.PatchEnvironment("PATH", c.MkDir())
+	err := agenttools.UnpackTools(t.dataDir, testTools, bytes.NewReader(data))
+	c.Assert(err, gc.ErrorMatches, `xz command \(needed to unpack xz-compressed tools\) not found`)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	_, err = os.Stat(t.toolsDir())
+	c.Assert(err, gc.FitsTypeOf, &os.PathError{})
+}
+
 func (t *ToolsSuite) TestReadToolsErrors(c *gc.C) {
 	vers := version.MustParseBinary("1.2.3-precise-amd64")
 	testTools, err := agenttools.ReadTools(t.dataDir, vers)
@@ -5,6 +5,8 @@ package tools
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/json"
@@ -12,6 +14,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"strings"
 
@@ -52,14 +55,90 @@ func ToolsDir(dataDir, agentName string) string {
 	return path.Join(dataDir, "tools", agentName)
 }
 
-// UnpackTools reads a set of juju tools in gzipped tar-archive
-// format and unpacks them into the appropriate tools directory
-// within dataDir. If a valid tools directory already exists,
+// xzMagic holds the bytes that begin every xz-compressed stream.
+var xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+// decompress returns a reader of the decompressed contents of r, which
+// must be compressed with either xz or gzip. The compression is detected
+// from the content rather than trusting any file name.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(xzMagic)); bytes.Equal(magic, xzMagic) {
+		return newXZReader(br)
+	}
+	return gzip.NewReader(br)
+}
+
+// newXZReader returns a reader of the xz-decompressed contents of r.
+// The standard library has no xz support, so the xz command is used;
+// an error satisfying errors.IsNotFound is returned if it is missing.
+func newXZReader(r io.Reader) (io.ReadCloser, error) {
+	xzPath, err := exec.LookPath("xz")
+	if err != nil {
+		return nil, errors.NotFoundf("xz command (needed to unpack xz-compressed tools)")
+	}
+	xr := &xzReader{cmd: exec.Command(xzPath, "--decompress", "--stdout")}
+	xr.cmd.Stdin = r
+	xr.cmd.Stderr = &xr.stderr
+	stdout, err := xr.cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	xr.stdout = stdout
+	if err := xr.cmd.Start(); err != nil {
+		return nil, errors.Annotate(err, "cannot run xz")
+	}
+	return xr, nil
+}
+
+// xzReader reads the output of an xz decompression command, reporting
+// the command's failure once its output is exhausted.
+type xzReader struct {
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stderr  bytes.Buffer
+	waited  bool
+	waitErr error
+}
+
+// Read is part of the io.Reader interface.
+func (r *xzReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		if err := r.wait(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Close is part of the io.Closer interface.
+func (r *xzReader) Close() error {
+	r.stdout.Close()
+	return r.wait()
+}
+
+func (r *xzReader) wait() error {
+	if !r.waited {
+		r.waited = true
+		if err := r.cmd.Wait(); err != nil {
+			if msg := strings.TrimSpace(r.stderr.String()); msg != "" {
+				err = errors.New(msg)
+			}
+			r.waitErr = errors.Annotate(err, "xz decompression failed")
+		}
+	}
+	return r.waitErr
+}
+
+// UnpackTools reads a set of juju tools in gzip- or xz-compressed
+// tar-archive format and unpacks them into the appropriate tools
+// directory within dataDir. If a valid tools directory already exists,
 // UnpackTools returns without error.
 func UnpackTools(dataDir string, tools *coretools.Tools, r io.Reader) (err error) {
-	// Unpack the gzip file and compute the checksum.
+	// Unpack the compressed file and compute the checksum.
 	sha256hash := sha256.New()
-	zr, err := gzip.NewReader(io.TeeReader(r, sha256hash))
+	zr, err := decompress(io.TeeReader(r, sha256hash))
 	if err != nil {
 		return err
 	}
@@ -73,9 +152,9 @@ func UnpackTools(dataDir string, tools *coretools.Tools, r io.Reader) (err error
 		return err
 	}
 	defer os.Remove(f.Name())
-	gzipSHA256 := fmt.Sprintf("%x", sha256hash.Sum(nil))
-	if tools.SHA256 != gzipSHA256 {
-		return fmt.Errorf("tarball sha256 mismatch, expected %s, got %s", tools.SHA256, gzipSHA256)
+	tarballSHA256 := fmt.Sprintf("%x", sha256hash.Sum(nil))
+	if tools.SHA256 != tarballSHA256 {
+		return fmt.Errorf("tarball sha256 mismatch, expected %s, got %s", tools.SHA256, tarballSHA256)
 	}
 
 	// Make a temporary directory in the tools directory,
@@ -29,7 +29,7 @@ func agentStatusFromStatusInfo(s []status.StatusInfo, kind status.HistoryKind) [
 		result = append(result, params.DetailedStatus{
 			Status: string(v.Status),
 			Info:   v.Message,
-			Data:   v.Data,
+			Data:   common.StatusData(v.Data),
 			Since:  v.Since,
 			Kind:   string(kind),
 		})
@@ -344,7 +344,7 @@ func (c *Client) modelStatus() (params.ModelStatusInfo, error) {
 		Status: status.Status.String(),
 		Info:   status.Message,
 		Since:  status.Since,
-		Data:   status.Data,
+		Data:   common.StatusData(status.Data),
 	}
 
 	return info, nil
@@ -834,7 +834,7 @@ func (context *statusContext) processApplication(application *state.Application)
 	}
 	processedStatus.Status.Status = applicationStatus.Status.String()
 	processedStatus.Status.Info = applicationStatus.Message
-	processedStatus.Status.Data = applicationStatus.Data
+	processedStatus.Status.Data = common.StatusData(applicationStatus.Data)
 	processedStatus.Status.Since = applicationStatus.Since
 
 	metrics := applicationCharm.Metrics()
@@ -40,11 +40,14 @@ func (s *StatusGetter) getEntityStatus(tag names.Tag) params.StatusResult {
 	switch getter := entity.(type) {
 	case status.StatusGetter:
 		statusInfo, err := getter.Status()
+		if err != nil {
+			result.Error = ServerError(err)
+			return result
+		}
 		result.Status = statusInfo.Status.String()
 		result.Info = statusInfo.Message
-		result.Data = statusInfo.Data
+		result.Data = StatusData(statusInfo.Data)
 		result.Since = statusInfo.Since
-		result.Error = ServerError(err)
 	default:
 		result.Error = ServerError(NotSupportedError(tag, fmt.Sprintf("getting status, %T", getter)))
 	}
@@ -164,7 +167,7 @@ func (s *ApplicationStatusGetter) Status(args params.Entities) (params.Applicati
 		}
 		result.Results[i].Application.Status = applicationStatus.Status.String()
 		result.Results[i].Application.Info = applicationStatus.Message
-		result.Results[i].Application.Data = applicationStatus.Data
+		result.Results[i].Application.Data = StatusData(applicationStatus.Data)
 		result.Results[i].Application.Since = applicationStatus.Since
 
 		result.Results[i].Units = make(map[string]params.StatusResult, len(unitStatuses))
@@ -172,7 +175,7 @@ func (s *ApplicationStatusGetter) Status(args params.Entities) (params.Applicati
 			ur := params.StatusResult{
 				Status: r.Status.String(),
 				Info:   r.Message,
-				Data:   r.Data,
+				Data:   StatusData(r.Data),
 				Since:  r.Since,
 			}
 			result.Results[i].Units[uTag] = ur
@@ -190,3 +193,13 @@ func EntityStatusFromState(statusInfo status.StatusInfo) params.EntityStatus {
 		Since:  statusInfo.Since,
 	}
 }
+
+// StatusData returns the given status data, or an empty map if it is
+// nil. State reports no data for statuses that have none, but clients
+// have always been sent an empty object rather than null.
+func StatusData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return map[string]interface{}{}
+	}
+	return data
+}
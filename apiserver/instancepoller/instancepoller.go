@@ -181,10 +181,12 @@ func (a *InstancePollerAPI) InstanceStatus(args params.Entities) (params.StatusR
 		if err == nil {
 			var statusInfo status.StatusInfo
 			statusInfo, err = machine.InstanceStatus()
-			result.Results[i].Status = statusInfo.Status.String()
-			result.Results[i].Info = statusInfo.Message
-			result.Results[i].Data = statusInfo.Data
-			result.Results[i].Since = statusInfo.Since
+			if err == nil {
+				result.Results[i].Status = statusInfo.Status.String()
+				result.Results[i].Info = statusInfo.Message
+				result.Results[i].Data = common.StatusData(statusInfo.Data)
+				result.Results[i].Since = statusInfo.Since
+			}
 		}
 		result.Results[i].Error = common.ServerError(err)
 	}
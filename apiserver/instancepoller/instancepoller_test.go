@@ -366,7 +366,7 @@ func (s *InstancePollerSuite) TestStatusSuccess(c *gc.C) {
 				Data:   s1.Data,
 				Since:  s1.Since,
 			},
-			{Status: "", Info: "", Data: nil, Since: nil},
+			{Status: "", Info: "", Data: map[string]interface{}{}, Since: nil},
 			{Error: apiservertesting.NotFoundError("machine 42")},
 			{Error: apiservertesting.ErrUnauthorized},
 			{Error: apiservertesting.ServerError(`"invalid-tag" is not a valid tag`)},
@@ -541,8 +541,8 @@ func (s *InstancePollerSuite) TestInstanceStatusSuccess(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	c.Assert(result, jc.DeepEquals, params.StatusResults{
 		Results: []params.StatusResult{
-			{Status: "foo"},
-			{Status: ""},
+			{Status: "foo", Data: map[string]interface{}{}},
+			{Status: "", Data: map[string]interface{}{}},
 			{Error: apiservertesting.NotFoundError("machine 42")},
 			{Error: apiservertesting.ServerError(`"application-unknown" is not a valid machine tag`)},
 			{Error: apiservertesting.ServerError(`"invalid-tag" is not a valid tag`)},
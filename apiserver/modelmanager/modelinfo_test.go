@@ -22,6 +22,7 @@ import (
 	"github.com/juju/juju/cloud"
 	"github.com/juju/juju/controller"
 	"github.com/juju/juju/core/description"
+	"github.com/juju/juju/core/migration"
 	"github.com/juju/juju/environs"
 	"github.com/juju/juju/environs/config"
 	"github.com/juju/juju/instance"
@@ -289,6 +290,7 @@ func (s *modelInfoSuite) TestRunningMigration(c *gc.C) {
 	start := time.Now().Add(-20 * time.Minute)
 	s.st.migration = &mockMigration{
 		status: "computing optimal bin packing",
+		phase:  migration.IMPORT,
 		start:  start,
 	}
 
@@ -299,6 +301,7 @@ func (s *modelInfoSuite) TestRunningMigration(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	migrationResult := results.Results[0].Result.Migration
 	c.Assert(migrationResult.Status, gc.Equals, "computing optimal bin packing")
+	c.Assert(migrationResult.Phase, gc.Equals, "IMPORT")
 	c.Assert(*migrationResult.Start, gc.Equals, start)
 	c.Assert(migrationResult.End, gc.IsNil)
 }
@@ -308,6 +311,7 @@ func (s *modelInfoSuite) TestFailedMigration(c *gc.C) {
 	end := time.Now().Add(-10 * time.Minute)
 	s.st.migration = &mockMigration{
 		status: "couldn't realign alternate time frames",
+		phase:  migration.ABORTDONE,
 		start:  start,
 		end:    end,
 	}
@@ -772,10 +776,15 @@ type mockMigration struct {
 	state.ModelMigration
 
 	status string
+	phase  migration.Phase
 	start  time.Time
 	end    time.Time
 }
 
+func (m *mockMigration) Phase() (migration.Phase, error) {
+	return m.phase, nil
+}
+
 func (m *mockMigration) StatusMessage() string {
 	return m.status
 }
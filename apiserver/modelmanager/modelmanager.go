@@ -635,6 +635,10 @@ func (m *ModelManagerAPI) getModelInfo(tag names.ModelTag) (params.ModelInfo, er
 		return params.ModelInfo{}, errors.Trace(err)
 	}
 	if err == nil {
+		phase, err := migration.Phase()
+		if err != nil {
+			return params.ModelInfo{}, errors.Trace(err)
+		}
 		startTime := migration.StartTime()
 		endTime := new(time.Time)
 		*endTime = migration.EndTime()
@@ -644,6 +648,7 @@ func (m *ModelManagerAPI) getModelInfo(tag names.ModelTag) (params.ModelInfo, er
 		}
 		info.Migration = &params.ModelMigrationStatus{
 			Status: migration.StatusMessage(),
+			Phase:  phase.String(),
 			Start:  &startTime,
 			End:    endTime,
 		}
@@ -212,6 +212,10 @@ func IsCodeUpgradeInProgress(err error) bool {
 	return ErrCode(err) == CodeUpgradeInProgress
 }
 
+func IsCodeMigrationInProgress(err error) bool {
+	return ErrCode(err) == CodeMigrationInProgress
+}
+
 func IsCodeOperationBlocked(err error) bool {
 	return ErrCode(err) == CodeOperationBlocked
 }
@@ -239,3 +243,20 @@ func IsMethodNotAllowed(err error) bool {
 func IsRedirect(err error) bool {
 	return ErrCode(err) == CodeRedirect
 }
+
+func IsCodeForbidden(err error) bool {
+	return ErrCode(err) == CodeForbidden
+}
+
+// IsCodeStatusUnavailable reports whether err is one of the errors
+// the status facades return in a StatusResult or ApplicationStatusResult
+// when the status of an entity cannot currently be read: the entity
+// does not exist (or the caller may not know that it does), or its
+// model is being migrated.
+func IsCodeStatusUnavailable(err error) bool {
+	switch ErrCode(err) {
+	case CodeNotFound, CodeUnauthorized, CodeMigrationInProgress:
+		return true
+	}
+	return false
+}
@@ -5,6 +5,7 @@ package params_test
 
 import (
 	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/juju/apiserver/params"
@@ -25,3 +26,28 @@ func (*errorSuite) TestErrCode(c *gc.C) {
 	err = errors.Trace(err)
 	c.Check(params.ErrCode(err), gc.Equals, params.CodeDead)
 }
+
+func (*errorSuite) TestIsCodeStatusUnavailable(c *gc.C) {
+	for _, test := range []struct {
+		code   string
+		expect bool
+	}{
+		{params.CodeNotFound, true},
+		{params.CodeUnauthorized, true},
+		{params.CodeMigrationInProgress, true},
+		{params.CodeForbidden, false},
+		{params.CodeDead, false},
+		{"", false},
+	} {
+		err := errors.Trace(&params.Error{Code: test.code, Message: "boom"})
+		c.Check(params.IsCodeStatusUnavailable(err), gc.Equals, test.expect, gc.Commentf("code %q", test.code))
+	}
+	c.Check(params.IsCodeStatusUnavailable(nil), jc.IsFalse)
+}
+
+func (*errorSuite) TestIsCodeMigrationInProgress(c *gc.C) {
+	err := &params.Error{Code: params.CodeMigrationInProgress}
+	c.Check(params.IsCodeMigrationInProgress(err), jc.IsTrue)
+	c.Check(params.IsCodeForbidden(err), jc.IsFalse)
+	c.Check(params.IsCodeForbidden(&params.Error{Code: params.CodeForbidden}), jc.IsTrue)
+}
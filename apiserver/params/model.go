@@ -110,6 +110,7 @@ type SetModelAgentVersion struct {
 // failed) migration.
 type ModelMigrationStatus struct {
 	Status string     `json:"status"`
+	Phase  string     `json:"phase,omitempty"`
 	Start  *time.Time `json:"start"`
 	End    *time.Time `json:"end,omitempty"`
 }
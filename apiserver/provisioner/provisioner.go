@@ -311,7 +311,7 @@ func (p *ProvisionerAPI) MachinesWithTransientErrors() (params.StatusResults, er
 		}
 		result.Status = statusInfo.Status.String()
 		result.Info = statusInfo.Message
-		result.Data = statusInfo.Data
+		result.Data = common.StatusData(statusInfo.Data)
 		if statusInfo.Status != status.Error && statusInfo.Status != status.ProvisioningError {
 			continue
 		}
@@ -890,10 +890,12 @@ func (p *ProvisionerAPI) InstanceStatus(args params.Entities) (params.StatusResu
 		if err == nil {
 			var statusInfo status.StatusInfo
 			statusInfo, err = machine.InstanceStatus()
-			result.Results[i].Status = statusInfo.Status.String()
-			result.Results[i].Info = statusInfo.Message
-			result.Results[i].Data = statusInfo.Data
-			result.Results[i].Since = statusInfo.Since
+			if err == nil {
+				result.Results[i].Status = statusInfo.Status.String()
+				result.Results[i].Info = statusInfo.Message
+				result.Results[i].Data = common.StatusData(statusInfo.Data)
+				result.Results[i].Since = statusInfo.Since
+			}
 		}
 		result.Results[i].Error = common.ServerError(err)
 	}
@@ -367,8 +367,8 @@ func (s *withoutControllerSuite) TestSetStatus(c *gc.C) {
 
 	// Verify the changes.
 	s.assertStatus(c, 0, status.Error, "not really", map[string]interface{}{"foo": "bar"})
-	s.assertStatus(c, 1, status.Stopped, "foobar", map[string]interface{}{})
-	s.assertStatus(c, 2, status.Started, "again", map[string]interface{}{})
+	s.assertStatus(c, 1, status.Stopped, "foobar", nil)
+	s.assertStatus(c, 2, status.Started, "again", nil)
 }
 
 func (s *withoutControllerSuite) TestSetInstanceStatus(c *gc.C) {
@@ -420,10 +420,10 @@ func (s *withoutControllerSuite) TestSetInstanceStatus(c *gc.C) {
 
 	// Verify the changes.
 	s.assertInstanceStatus(c, 0, status.Provisioning, "not really", map[string]interface{}{"foo": "bar"})
-	s.assertInstanceStatus(c, 1, status.Running, "foobar", map[string]interface{}{})
-	s.assertInstanceStatus(c, 2, status.ProvisioningError, "again", map[string]interface{}{})
+	s.assertInstanceStatus(c, 1, status.Running, "foobar", nil)
+	s.assertInstanceStatus(c, 2, status.ProvisioningError, "again", nil)
 	// ProvisioningError also has a special case which is to set the machine to Error
-	s.assertStatus(c, 2, status.Error, "again", map[string]interface{}{})
+	s.assertStatus(c, 2, status.Error, "again", nil)
 }
 
 func (s *withoutControllerSuite) TestMachinesWithTransientErrors(c *gc.C) {
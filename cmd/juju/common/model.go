@@ -44,6 +44,8 @@ type ModelStatus struct {
 	Migration      string        `json:"migration,omitempty" yaml:"migration,omitempty"`
 	MigrationStart string        `json:"migration-start,omitempty" yaml:"migration-start,omitempty"`
 	MigrationEnd   string        `json:"migration-end,omitempty" yaml:"migration-end,omitempty"`
+	MigrationPhase string        `json:"migration-phase,omitempty" yaml:"migration-phase,omitempty"`
+	Migrating      bool          `json:"migrating,omitempty" yaml:"migrating,omitempty"`
 }
 
 // ModelUserInfo defines the serialization behaviour of the model user
@@ -51,7 +53,7 @@ type ModelStatus struct {
 type ModelUserInfo struct {
 	DisplayName    string `yaml:"display-name,omitempty" json:"display-name,omitempty"`
 	Access         string `yaml:"access" json:"access"`
-	LastConnection string `yaml:"last-connection" json:"last-connection"`
+	LastConnection string `yaml:"last-connection,omitempty" json:"last-connection,omitempty"`
 }
 
 // friendlyDuration renders a time pointer that we get from the API as
@@ -78,6 +80,8 @@ func ModelInfoFromParams(info params.ModelInfo, now time.Time) (ModelInfo, error
 		status.Migration = info.Migration.Status
 		status.MigrationStart = friendlyDuration(info.Migration.Start, now)
 		status.MigrationEnd = friendlyDuration(info.Migration.End, now)
+		status.MigrationPhase = info.Migration.Phase
+		status.Migrating = info.Migration.End == nil
 	}
 	cloudTag, err := names.ParseCloudTag(info.CloudTag)
 	if err != nil {
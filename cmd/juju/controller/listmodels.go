@@ -28,7 +28,7 @@ func NewListModelsCommand() cmd.Command {
 }
 
 // modelsCommand returns the list of all the models the
-// current user can access on the current controller.
+// current user can access on the selected controller.
 type modelsCommand struct {
 	modelcmd.ControllerCommandBase
 	out          cmd.Output
@@ -37,6 +37,9 @@ type modelsCommand struct {
 	user         string
 	listUUID     bool
 	exactTime    bool
+	wide         bool
+	cloud        string
+	region       string
 	modelAPI     ModelManagerAPI
 	sysAPI       ModelsSysAPI
 }
@@ -51,6 +54,10 @@ Examples:
 
     juju models
     juju models --user bob
+    juju models -c mycontroller
+    juju models --cloud aws --region us-east-1
+    juju models --wide
+    juju models --format json --output models.json
 
 See also:
     add-model
@@ -104,6 +111,9 @@ func (c *modelsCommand) SetFlags(f *gnuflag.FlagSet) {
 	f.BoolVar(&c.all, "all", false, "Lists all models, regardless of user accessibility (administrative users only)")
 	f.BoolVar(&c.listUUID, "uuid", false, "Display UUID for models")
 	f.BoolVar(&c.exactTime, "exact-time", false, "Use full timestamps")
+	f.BoolVar(&c.wide, "wide", false, "Display all columns in tabular output")
+	f.StringVar(&c.cloud, "cloud", "", "Only list models on the named cloud")
+	f.StringVar(&c.region, "region", "", "Only list models in the named cloud region")
 	c.out.AddFlags(f, "tabular", map[string]cmd.Formatter{
 		"yaml":    cmd.FormatYaml,
 		"json":    cmd.FormatJson,
@@ -125,6 +135,9 @@ type ModelSet struct {
 	// CurrentModelQualified is the fully qualified name for the current
 	// model, i.e. having the format $owner/$model.
 	CurrentModelQualified string `yaml:"-" json:"-"`
+
+	// ModelCount is the number of models listed.
+	ModelCount int `yaml:"model-count" json:"model-count"`
 }
 
 // Run implements Command.Run
@@ -164,10 +177,15 @@ func (c *modelsCommand) Run(ctx *cmd.Context) error {
 			return errors.Trace(err)
 		}
 		model.ControllerName = c.ControllerName()
+		setLastConnectionTimestamps(model.Users, info.Users)
 		modelInfo = append(modelInfo, model)
 	}
+	modelInfo, err = c.filterModels(modelInfo)
+	if err != nil {
+		return errors.Trace(err)
+	}
 
-	modelSet := ModelSet{Models: modelInfo}
+	modelSet := ModelSet{Models: modelInfo, ModelCount: len(modelInfo)}
 	current, err := c.ClientStore().CurrentModel(c.ControllerName())
 	if err != nil && !errors.IsNotFound(err) {
 		return err
@@ -196,6 +214,33 @@ func (c *modelsCommand) Run(ctx *cmd.Context) error {
 	return nil
 }
 
+// filterModels returns the models that match the cloud and region
+// specified with --cloud and --region. It is an error for the named
+// cloud to have none of the models on it.
+func (c *modelsCommand) filterModels(models []common.ModelInfo) ([]common.ModelInfo, error) {
+	if c.cloud == "" && c.region == "" {
+		return models, nil
+	}
+	var foundCloud bool
+	filtered := make([]common.ModelInfo, 0, len(models))
+	for _, model := range models {
+		if c.cloud != "" {
+			if model.Cloud != c.cloud {
+				continue
+			}
+			foundCloud = true
+		}
+		if c.region != "" && model.CloudRegion != c.region {
+			continue
+		}
+		filtered = append(filtered, model)
+	}
+	if c.cloud != "" && !foundCloud {
+		return nil, errors.Errorf("no models found on cloud %q", c.cloud)
+	}
+	return filtered, nil
+}
+
 func (c *modelsCommand) getModelInfo(userModels []base.UserModel) ([]params.ModelInfo, error) {
 	client, err := c.getModelManagerAPI()
 	if err != nil {
@@ -267,27 +312,35 @@ func (c *modelsCommand) formatTabular(writer io.Writer, value interface{}) error
 		userForLastConn = userForListing
 	}
 
+	now := time.Now()
 	tw := output.TabWriter(writer)
 	w := output.Wrapper{tw}
 	w.Println("Controller: " + c.ControllerName())
 	w.Println()
+	// With --wide, all columns are shown; otherwise the UUID column
+	// is shown only if requested, and the provider type not at all.
+	showUUID := c.listUUID || c.wide
+	showType := c.wide
 	w.Print("Model")
-	if c.listUUID {
+	offset := 0
+	if showUUID {
 		w.Print("UUID")
+		offset++
+	}
+	if showType {
+		w.Print("Type")
+		offset++
 	}
 	// Only owners, or users with write access or above get to see machines and cores.
-	haveMachineInfo := false
+	haveMachineInfo := c.wide
 	for _, m := range modelSet.Models {
-		if haveMachineInfo = len(m.Machines) > 0; haveMachineInfo {
+		if haveMachineInfo {
 			break
 		}
+		haveMachineInfo = len(m.Machines) > 0
 	}
 	if haveMachineInfo {
 		w.Println("Cloud/Region", "Status", "Machines", "Cores", "Access", "Last connection")
-		offset := 0
-		if c.listUUID {
-			offset++
-		}
 		tw.SetColumnAlignRight(3 + offset)
 		tw.SetColumnAlignRight(4 + offset)
 	} else {
@@ -303,19 +356,24 @@ func (c *modelsCommand) formatTabular(writer io.Writer, value interface{}) error
 		} else {
 			w.Print(name)
 		}
-		if c.listUUID {
+		if showUUID {
 			w.Print(model.UUID)
 		}
-		lastConnection := model.Users[userForLastConn.Id()].LastConnection
-		if lastConnection == "" {
-			lastConnection = "never connected"
+		if showType {
+			w.Print(model.ProviderType)
+		}
+		lastConnection, err := formatLastConnection(
+			model.Users[userForLastConn.Id()].LastConnection, now, c.exactTime,
+		)
+		if err != nil {
+			return errors.Trace(err)
 		}
 		userForAccess := loggedInUser
 		if c.user != "" {
 			userForAccess = names.NewUserTag(c.user)
 		}
 		access := model.Users[userForAccess.Id()].Access
-		w.Print(cloudRegion, model.Status.Current)
+		w.Print(cloudRegion, modelStatusSummary(model.Status))
 		if haveMachineInfo {
 			machineInfo := fmt.Sprintf("%d", len(model.Machines))
 			cores := uint64(0)
@@ -331,5 +389,64 @@ func (c *modelsCommand) formatTabular(writer io.Writer, value interface{}) error
 		w.Println(access, lastConnection)
 	}
 	tw.Flush()
+	if len(modelSet.Models) > 0 {
+		fmt.Fprintf(writer, "\n%s\n", modelCountSummary(len(modelSet.Models)))
+	}
 	return nil
 }
+
+// setLastConnectionTimestamps replaces the last connection times in
+// users, which are rendered for humans, with RFC3339 timestamps taken
+// from the API results. This keeps the structured output machine
+// readable regardless of how the tabular output renders the times.
+// Users that have never connected are left without a timestamp.
+func setLastConnectionTimestamps(users map[string]common.ModelUserInfo, results []params.ModelUserInfo) {
+	for _, result := range results {
+		name := names.NewUserTag(result.UserName).Id()
+		user, ok := users[name]
+		if !ok {
+			continue
+		}
+		user.LastConnection = ""
+		if result.LastConnection != nil {
+			user.LastConnection = result.LastConnection.UTC().Format(time.RFC3339)
+		}
+		users[name] = user
+	}
+}
+
+// formatLastConnection returns the value shown in the Last connection
+// column of the tabular output, given an RFC3339 timestamp as set by
+// setLastConnectionTimestamps.
+func formatLastConnection(timestamp string, now time.Time, exact bool) (string, error) {
+	if timestamp == "" {
+		return common.LastConnection(nil, now, exact), nil
+	}
+	when, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return "", errors.Annotate(err, "parsing last connection time")
+	}
+	return common.LastConnection(&when, now, exact), nil
+}
+
+// modelCountSummary returns the summary line printed after the
+// tabular output, e.g. "3 models".
+func modelCountSummary(n int) string {
+	if n == 1 {
+		return "1 model"
+	}
+	return fmt.Sprintf("%d models", n)
+}
+
+// modelStatusSummary returns the value shown in the Status column of the
+// tabular output. A model that is being migrated is shown as migrating,
+// along with the current migration phase if it is known.
+func modelStatusSummary(modelStatus common.ModelStatus) string {
+	if !modelStatus.Migrating {
+		return string(modelStatus.Current)
+	}
+	if modelStatus.MigrationPhase == "" {
+		return "migrating"
+	}
+	return fmt.Sprintf("migrating (%s)", modelStatus.MigrationPhase)
+}
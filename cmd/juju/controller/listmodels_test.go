@@ -4,6 +4,9 @@
 package controller_test
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/juju/cmd"
@@ -35,6 +38,8 @@ type fakeModelMgrAPIClient struct {
 	models       []base.UserModel
 	all          bool
 	inclMachines bool
+	clouds       map[string]string // model name -> cloud/region
+	migrations   map[string]*params.ModelMigrationStatus
 }
 
 func (f *fakeModelMgrAPIClient) Close() error {
@@ -66,11 +71,20 @@ func (f *fakeModelMgrAPIClient) ModelInfo(tags []names.ModelTag) ([]params.Model
 				continue
 			}
 			result := &params.ModelInfo{
-				Name:     model.Name,
-				UUID:     model.UUID,
-				OwnerTag: names.NewUserTag(model.Owner).String(),
-				CloudTag: "cloud-dummy",
+				Name:         model.Name,
+				UUID:         model.UUID,
+				OwnerTag:     names.NewUserTag(model.Owner).String(),
+				CloudTag:     "cloud-dummy",
+				ProviderType: "dummy",
 			}
+			if cloudRegion, ok := f.clouds[model.Name]; ok {
+				parts := strings.SplitN(cloudRegion, "/", 2)
+				result.CloudTag = names.NewCloudTag(parts[0]).String()
+				if len(parts) > 1 {
+					result.CloudRegion = parts[1]
+				}
+			}
+			result.Migration = f.migrations[model.Name]
 			switch model.Name {
 			case "test-model1":
 				last1 := time.Date(2015, 3, 20, 0, 0, 0, 0, time.UTC)
@@ -156,6 +170,8 @@ func (s *ModelsSuite) TestModelsOwner(c *gc.C) {
 		"test-model1*                 dummy         active      read    2015-03-20\n"+
 		"carlotta/test-model2         dummy         active      write   2015-03-01\n"+
 		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
 		"\n")
 }
 
@@ -170,6 +186,8 @@ func (s *ModelsSuite) TestModelsNonOwner(c *gc.C) {
 		"admin/test-model1*           dummy         active      read    2015-03-20\n"+
 		"carlotta/test-model2         dummy         active      write   2015-03-01\n"+
 		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
 		"\n")
 }
 
@@ -184,6 +202,8 @@ func (s *ModelsSuite) TestAllModels(c *gc.C) {
 		"admin/test-model1*           dummy         active      read    2015-03-20\n"+
 		"carlotta/test-model2         dummy         active      write   2015-03-01\n"+
 		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
 		"\n")
 }
 
@@ -198,7 +218,41 @@ func (s *ModelsSuite) TestAllModelsNoneCurrent(c *gc.C) {
 		"test-model1                  dummy         active      read    2015-03-20\n"+
 		"carlotta/test-model2         dummy         active      write   2015-03-01\n"+
 		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
+		"\n")
+}
+
+func (s *ModelsSuite) TestModelsNonCurrentController(c *gc.C) {
+	s.store.Controllers["other"] = jujuclient.ControllerDetails{}
+	s.store.Models["other"] = &jujuclient.ControllerModels{
+		CurrentModel: "carlotta/test-model2",
+	}
+	s.store.Accounts["other"] = jujuclient.AccountDetails{
+		User:     "bob",
+		Password: "password",
+	}
+
+	context, err := testing.RunCommand(c, s.newCommand(), "-c", "other")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.api.user, gc.Equals, "bob")
+	c.Assert(testing.Stdout(context), gc.Equals, ""+
+		"Controller: other\n"+
+		"\n"+
+		"Model                        Cloud/Region  Status      Access  Last connection\n"+
+		"admin/test-model1            dummy         active      read    2015-03-20\n"+
+		"carlotta/test-model2*        dummy         active      write   2015-03-01\n"+
+		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
 		"\n")
+
+	context, err = testing.RunCommand(c, s.newCommand(), "-c", "other", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	out := testing.Stdout(context)
+	c.Assert(out, jc.Contains, "controller-name: other\n")
+	c.Assert(out, gc.Not(jc.Contains), "controller-name: fake\n")
+	c.Assert(out, jc.Contains, "current-model: carlotta/test-model2\n")
 }
 
 func (s *ModelsSuite) TestModelsUUID(c *gc.C) {
@@ -213,6 +267,8 @@ func (s *ModelsSuite) TestModelsUUID(c *gc.C) {
 		"test-model1*                 test-model1-UUID  dummy         active             2      1  read    2015-03-20\n"+
 		"carlotta/test-model2         test-model2-UUID  dummy         active             0      -  write   2015-03-01\n"+
 		"daiwik@external/test-model3  test-model3-UUID  dummy         destroying         0      -          never connected\n"+
+		"\n"+
+		"3 models\n"+
 		"\n")
 }
 
@@ -228,6 +284,168 @@ func (s *ModelsSuite) TestModelsMachineInfo(c *gc.C) {
 		"test-model1*                 dummy         active             2      1  read    2015-03-20\n"+
 		"carlotta/test-model2         dummy         active             0      -  write   2015-03-01\n"+
 		"daiwik@external/test-model3  dummy         destroying         0      -          never connected\n"+
+		"\n"+
+		"3 models\n"+
+		"\n")
+}
+
+func (s *ModelsSuite) TestModelsWide(c *gc.C) {
+	// --wide shows the machine columns even when
+	// no model has any machine information.
+	context, err := testing.RunCommand(c, s.newCommand(), "--wide")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), gc.Equals, ""+
+		"Controller: fake\n"+
+		"\n"+
+		"Model                        UUID              Type   Cloud/Region  Status      Machines  Cores  Access  Last connection\n"+
+		"test-model1*                 test-model1-UUID  dummy  dummy         active             0      -  read    2015-03-20\n"+
+		"carlotta/test-model2         test-model2-UUID  dummy  dummy         active             0      -  write   2015-03-01\n"+
+		"daiwik@external/test-model3  test-model3-UUID  dummy  dummy         destroying         0      -          never connected\n"+
+		"\n"+
+		"3 models\n"+
+		"\n")
+}
+
+func (s *ModelsSuite) TestModelsOutputFile(c *gc.C) {
+	outPath := filepath.Join(c.MkDir(), "models.txt")
+	context, err := testing.RunCommand(c, s.newCommand(), "--output", outPath)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), gc.Equals, "")
+	data, err := ioutil.ReadFile(outPath)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, ""+
+		"Controller: fake\n"+
+		"\n"+
+		"Model                        Cloud/Region  Status      Access  Last connection\n"+
+		"test-model1*                 dummy         active      read    2015-03-20\n"+
+		"carlotta/test-model2         dummy         active      write   2015-03-01\n"+
+		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
+		"\n")
+}
+
+func (s *ModelsSuite) TestModelsOutputFileError(c *gc.C) {
+	outPath := filepath.Join(c.MkDir(), "missing", "models.json")
+	_, err := testing.RunCommand(c, s.newCommand(), "--format", "json", "-o", outPath)
+	c.Assert(err, gc.ErrorMatches, ".*no such file or directory")
+}
+
+func (s *ModelsSuite) TestModelsCloudRegion(c *gc.C) {
+	s.api.clouds = map[string]string{
+		"test-model1": "aws/us-east-1",
+		"test-model2": "aws/us-west-1",
+	}
+	context, err := testing.RunCommand(c, s.newCommand(), "--cloud", "aws")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), gc.Equals, ""+
+		"Controller: fake\n"+
+		"\n"+
+		"Model                 Cloud/Region   Status  Access  Last connection\n"+
+		"test-model1*          aws/us-east-1  active  read    2015-03-20\n"+
+		"carlotta/test-model2  aws/us-west-1  active  write   2015-03-01\n"+
+		"\n"+
+		"2 models\n"+
+		"\n")
+
+	context, err = testing.RunCommand(c, s.newCommand(), "--cloud", "aws", "--region", "us-west-1")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), gc.Equals, ""+
+		"Controller: fake\n"+
+		"\n"+
+		"Model                 Cloud/Region   Status  Access  Last connection\n"+
+		"carlotta/test-model2  aws/us-west-1  active  write   2015-03-01\n"+
+		"\n"+
+		"1 model\n"+
+		"\n")
+}
+
+func (s *ModelsSuite) TestModelsCloudNotFound(c *gc.C) {
+	_, err := testing.RunCommand(c, s.newCommand(), "--cloud", "aws")
+	c.Assert(err, gc.ErrorMatches, `no models found on cloud "aws"`)
+}
+
+func (s *ModelsSuite) TestModelsMigrating(c *gc.C) {
+	start := time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC)
+	s.api.migrations = map[string]*params.ModelMigrationStatus{
+		"test-model2": {
+			Status: "importing model",
+			Phase:  "IMPORT",
+			Start:  &start,
+		},
+	}
+	context, err := testing.RunCommand(c, s.newCommand())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), gc.Equals, ""+
+		"Controller: fake\n"+
+		"\n"+
+		"Model                        Cloud/Region  Status              Access  Last connection\n"+
+		"test-model1*                 dummy         active              read    2015-03-20\n"+
+		"carlotta/test-model2         dummy         migrating (IMPORT)  write   2015-03-01\n"+
+		"daiwik@external/test-model3  dummy         destroying                  never connected\n"+
+		"\n"+
+		"3 models\n"+
+		"\n")
+
+	context, err = testing.RunCommand(c, s.newCommand(), "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	out := testing.Stdout(context)
+	c.Assert(strings.Count(out, "migrating: true"), gc.Equals, 1)
+	c.Assert(out, jc.Contains, "migration-phase: IMPORT")
+}
+
+func (s *ModelsSuite) TestModelsMigrationFinished(c *gc.C) {
+	start := time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	s.api.migrations = map[string]*params.ModelMigrationStatus{
+		"test-model2": {
+			Status: "migration aborted",
+			Phase:  "ABORTDONE",
+			Start:  &start,
+			End:    &end,
+		},
+	}
+	context, err := testing.RunCommand(c, s.newCommand())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), jc.Contains, "carlotta/test-model2         dummy         active      write   2015-03-01\n")
+}
+
+func (s *ModelsSuite) TestModelsCountJSON(c *gc.C) {
+	context, err := testing.RunCommand(c, s.newCommand(), "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), jc.Contains, `"model-count":3`)
+}
+
+func (s *ModelsSuite) TestModelsLastConnectionRFC3339(c *gc.C) {
+	for _, args := range [][]string{
+		{"--format", "yaml"},
+		{"--format", "yaml", "--exact-time"},
+	} {
+		context, err := testing.RunCommand(c, s.newCommand(), args...)
+		c.Assert(err, jc.ErrorIsNil)
+		out := testing.Stdout(context)
+		c.Check(out, gc.Matches, `(?s).*last-connection: "?2015-03-20T00:00:00Z"?\n.*`)
+		c.Check(out, gc.Matches, `(?s).*last-connection: "?2015-03-01T00:00:00Z"?\n.*`)
+		c.Check(out, gc.Not(jc.Contains), "never connected")
+	}
+
+	context, err := testing.RunCommand(c, s.newCommand(), "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(testing.Stdout(context), jc.Contains, `"last-connection":"2015-03-20T00:00:00Z"`)
+}
+
+func (s *ModelsSuite) TestModelsExactTime(c *gc.C) {
+	context, err := testing.RunCommand(c, s.newCommand(), "--exact-time")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testing.Stdout(context), gc.Equals, ""+
+		"Controller: fake\n"+
+		"\n"+
+		"Model                        Cloud/Region  Status      Access  Last connection\n"+
+		"test-model1*                 dummy         active      read    2015-03-20 00:00:00 +0000 UTC\n"+
+		"carlotta/test-model2         dummy         active      write   2015-03-01 00:00:00 +0000 UTC\n"+
+		"daiwik@external/test-model3  dummy         destroying          never connected\n"+
+		"\n"+
+		"3 models\n"+
 		"\n")
 }
 
@@ -165,6 +165,42 @@ type unitStatus struct {
 	Subordinates  map[string]unitStatus `json:"subordinates,omitempty" yaml:"subordinates,omitempty"`
 }
 
+// hasAnyStatus reports whether any application, or any unit's workload
+// or agent, has one of the given statuses.
+func (s *formattedStatus) hasAnyStatus(statuses []status.Status) bool {
+	matches := func(info statusInfoContents) bool {
+		for _, st := range statuses {
+			if info.Current == st {
+				return true
+			}
+		}
+		return false
+	}
+	var unitMatches func(u unitStatus) bool
+	unitMatches = func(u unitStatus) bool {
+		if matches(u.WorkloadStatusInfo) || matches(u.JujuStatusInfo) {
+			return true
+		}
+		for _, sub := range u.Subordinates {
+			if unitMatches(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, app := range s.Applications {
+		if matches(app.StatusInfo) {
+			return true
+		}
+		for _, u := range app.Units {
+			if unitMatches(u) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s *formattedStatus) applicationScale(name string) (string, bool) {
 	// The current unit count are units that are either in Idle or Executing status.
 	// In other words, units that are active and available.
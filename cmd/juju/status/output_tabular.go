@@ -280,13 +280,31 @@ func getModelMessage(model modelStatus) string {
 
 func printMachines(tw *ansiterm.TabWriter, machines map[string]machineStatus) {
 	w := output.Wrapper{tw}
-	w.Println("Machine", "State", "DNS", "Inst id", "Series", "AZ")
+	// Controller membership is only shown when there
+	// are controller machines to report on.
+	haveControllers := haveControllerMachines(machines)
+	headers := []interface{}{"Machine", "State", "DNS", "Inst id", "Series", "AZ"}
+	if haveControllers {
+		headers = append(headers, "Controller")
+	}
+	w.Println(headers...)
 	for _, name := range utils.SortStringsNaturally(stringKeysFromMap(machines)) {
-		printMachine(w, machines[name])
+		printMachine(w, machines[name], haveControllers)
+	}
+}
+
+// haveControllerMachines reports whether any of the given
+// machines, or their containers, is a controller machine.
+func haveControllerMachines(machines map[string]machineStatus) bool {
+	for _, m := range machines {
+		if m.HAStatus != "" || haveControllerMachines(m.Containers) {
+			return true
+		}
 	}
+	return false
 }
 
-func printMachine(w output.Wrapper, m machineStatus) {
+func printMachine(w output.Wrapper, m machineStatus, haveControllers bool) {
 	// We want to display availability zone so extract from hardware info".
 	hw, err := instance.ParseHardware(m.Hardware)
 	if err != nil {
@@ -298,9 +316,13 @@ func printMachine(w output.Wrapper, m machineStatus) {
 	}
 	w.Print(m.Id)
 	w.PrintStatus(m.JujuStatus.Current)
-	w.Println(m.DNSName, m.InstanceId, m.Series, az)
+	if haveControllers {
+		w.Println(m.DNSName, m.InstanceId, m.Series, az, m.HAStatus)
+	} else {
+		w.Println(m.DNSName, m.InstanceId, m.Series, az)
+	}
 	for _, name := range utils.SortStringsNaturally(stringKeysFromMap(m.Containers)) {
-		printMachine(w, m.Containers[name])
+		printMachine(w, m.Containers[name], haveControllers)
 	}
 }
 
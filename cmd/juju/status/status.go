@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
@@ -17,6 +18,7 @@ import (
 	"github.com/juju/juju/apiserver/params"
 	"github.com/juju/juju/cmd/modelcmd"
 	"github.com/juju/juju/juju/osenv"
+	"github.com/juju/juju/status"
 )
 
 var logger = loggo.GetLogger("juju.cmd.juju.status")
@@ -40,8 +42,19 @@ type statusCommand struct {
 	api      statusAPI
 
 	color bool
+
+	// failOn holds the statuses which, if reported for any
+	// application or unit, cause the command to exit with
+	// failOnExitCode.
+	failOn     []status.Status
+	failOnFlag string
 }
 
+// failOnExitCode is the exit code used when any application or unit
+// has one of the statuses given with --fail-on. It is distinct from
+// the exit codes used when the command fails.
+const failOnExitCode = 3
+
 var usageSummary = `
 Reports the current status of the model, machines, applications and units.`[1:]
 
@@ -73,10 +86,15 @@ The available output formats are:
 - json: Displays information about the model, machines, applications, and units
       in structured JSON format.
 
+The --fail-on option takes a comma-separated list of statuses. If any
+application, or any unit's workload or agent, has one of those statuses, the
+status is displayed as usual and the command then exits with code 3.
+
 Examples:
     juju show-status
     juju show-status mysql
     juju show-status nova-*
+    juju show-status --fail-on error,blocked
 
 See also:
     machines
@@ -99,6 +117,7 @@ func (c *statusCommand) SetFlags(f *gnuflag.FlagSet) {
 	c.ModelCommandBase.SetFlags(f)
 	f.BoolVar(&c.isoTime, "utc", false, "Display time as UTC in RFC3339 format")
 	f.BoolVar(&c.color, "color", false, "Force use of ANSI color codes")
+	f.StringVar(&c.failOnFlag, "fail-on", "", "Exit with code 3 if any application or unit has one of these comma-separated statuses")
 
 	defaultFormat := "tabular"
 
@@ -115,6 +134,16 @@ func (c *statusCommand) SetFlags(f *gnuflag.FlagSet) {
 
 func (c *statusCommand) Init(args []string) error {
 	c.patterns = args
+	if c.failOnFlag != "" {
+		for _, value := range strings.Split(c.failOnFlag, ",") {
+			value = strings.TrimSpace(value)
+			s := status.Status(value)
+			if !s.KnownWorkloadStatus() && !s.KnownAgentStatus() {
+				return errors.NotValidf("--fail-on status %q", value)
+			}
+			c.failOn = append(c.failOn, s)
+		}
+	}
 	// If use of ISO time not specified on command line,
 	// check env var.
 	if !c.isoTime {
@@ -157,7 +186,13 @@ func (c *statusCommand) Run(ctx *cmd.Context) error {
 	if err != nil {
 		return err
 	}
-	return c.out.Write(ctx, formatted)
+	if err := c.out.Write(ctx, formatted); err != nil {
+		return err
+	}
+	if len(c.failOn) > 0 && formatted.hasAnyStatus(c.failOn) {
+		return cmd.NewRcPassthroughError(failOnExitCode)
+	}
+	return nil
 }
 
 func (c *statusCommand) FormatTabular(writer io.Writer, value interface{}) error {
@@ -3948,10 +3948,10 @@ mysql/0*      maintenance  idle   2        10.0.2.1               installing all
 wordpress/0*  active       idle   1        10.0.1.1               
   logging/0   active       idle            10.0.1.1               
 
-Machine  State    DNS       Inst id       Series   AZ
-0        started  10.0.0.1  controller-0  quantal  us-east-1a
-1        started  10.0.1.1  controller-1  quantal  
-2        started  10.0.2.1  controller-2  quantal  
+Machine  State    DNS       Inst id       Series   AZ          Controller
+0        started  10.0.0.1  controller-0  quantal  us-east-1a  adding-vote
+1        started  10.0.1.1  controller-1  quantal              
+2        started  10.0.2.1  controller-2  quantal              
 
 Relation           Provides   Consumes   Type
 juju-info          logging    mysql      regular
@@ -4015,6 +4015,42 @@ Machine  State  DNS  Inst id  Series  AZ
 `[1:])
 }
 
+func (s *StatusSuite) TestFormatTabularControllerMachines(c *gc.C) {
+	status := formattedStatus{
+		Machines: map[string]machineStatus{
+			"0": {
+				Id:         "0",
+				JujuStatus: statusInfoContents{Current: "started"},
+				InstanceId: "i-0",
+				Series:     "xenial",
+				HAStatus:   "has-vote",
+			},
+			"1": {
+				Id:         "1",
+				JujuStatus: statusInfoContents{Current: "started"},
+				InstanceId: "i-1",
+				Series:     "xenial",
+				HAStatus:   "removing-vote",
+			},
+			"2": {
+				Id:         "2",
+				JujuStatus: statusInfoContents{Current: "started"},
+				InstanceId: "i-2",
+				Series:     "xenial",
+			},
+		},
+	}
+	out := &bytes.Buffer{}
+	err := FormatTabular(out, false, status)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out.String(), jc.Contains, `
+Machine  State    DNS  Inst id  Series  AZ  Controller
+0        started       i-0      xenial      has-vote
+1        started       i-1      xenial      removing-vote
+2        started       i-2      xenial      
+`[1:])
+}
+
 func (s *StatusSuite) TestFormatTabularConsistentPeerRelationName(c *gc.C) {
 	status := formattedStatus{
 		Applications: map[string]applicationStatus{
@@ -4318,6 +4354,58 @@ func (s *StatusSuite) TestFilterToErrored(c *gc.C) {
 	c.Assert(string(stdout), gc.Equals, expected[1:])
 }
 
+func (s *StatusSuite) TestFailOn(c *gc.C) {
+	ctx := s.FilteringTestSetup(c)
+	defer s.resetContext(c, ctx)
+
+	code, _, stderr := runStatus(c, "--format", "oneline", "--fail-on", "error")
+	c.Check(code, gc.Equals, 0)
+	c.Check(string(stderr), gc.Equals, "")
+
+	// Given unit 1 of the "logging" service has an error
+	setAgentStatus{"logging/1", status.Error, "mock error", nil}.step(c, ctx)
+	code, stdout, stderr := runStatus(c, "--format", "oneline", "--fail-on", "blocked,error")
+	c.Check(code, gc.Equals, 3)
+	c.Check(string(stderr), gc.Equals, "")
+
+	// The output is the same as without --fail-on.
+	code, expected, _ := runStatus(c, "--format", "oneline")
+	c.Check(code, gc.Equals, 0)
+	c.Check(string(stdout), gc.Equals, string(expected))
+}
+
+func (s *StatusSuite) TestFailOnInvalidStatus(c *gc.C) {
+	code, _, stderr := runStatus(c, "--fail-on", "error,bogus")
+	c.Check(code, gc.Equals, 2)
+	c.Check(string(stderr), gc.Matches, `(?s).*--fail-on status "bogus" not valid\n`)
+}
+
+func (s *StatusSuite) TestFormattedStatusHasAnyStatus(c *gc.C) {
+	formatted := formattedStatus{
+		Applications: map[string]applicationStatus{
+			"foo": {
+				StatusInfo: statusInfoContents{Current: status.Active},
+				Units: map[string]unitStatus{
+					"foo/0": {
+						WorkloadStatusInfo: statusInfoContents{Current: status.Active},
+						JujuStatusInfo:     statusInfoContents{Current: status.Idle},
+						Subordinates: map[string]unitStatus{
+							"bar/0": {
+								WorkloadStatusInfo: statusInfoContents{Current: status.Blocked},
+								JujuStatusInfo:     statusInfoContents{Current: status.Executing},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	c.Check(formatted.hasAnyStatus([]status.Status{status.Error}), jc.IsFalse)
+	c.Check(formatted.hasAnyStatus([]status.Status{status.Error, status.Blocked}), jc.IsTrue)
+	c.Check(formatted.hasAnyStatus([]status.Status{status.Executing}), jc.IsTrue)
+	c.Check(formatted.hasAnyStatus([]status.Status{status.Active}), jc.IsTrue)
+}
+
 // Scenario: User filters to mysql service
 func (s *StatusSuite) TestFilterToService(c *gc.C) {
 	ctx := s.FilteringTestSetup(c)
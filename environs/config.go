@@ -5,6 +5,7 @@ package environs
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
@@ -21,7 +22,7 @@ type ProviderRegistry interface {
 	RegisterProvider(p EnvironProvider, providerType string, providerTypeAliases ...string) error
 
 	// RegisteredProviders returns the names of the registered environment
-	// providers.
+	// providers, in sorted order. Aliases are not included.
 	RegisteredProviders() []string
 
 	// Provider returns the environment provider with the specified name.
@@ -65,6 +66,7 @@ func (r *globalProviderRegistry) RegisteredProviders() []string {
 	for k := range r.providers {
 		p = append(p, k)
 	}
+	sort.Strings(p)
 	return p
 }
 
@@ -92,7 +94,8 @@ func RegisterProvider(name string, p EnvironProvider, alias ...string) {
 	}
 }
 
-// RegisteredProviders enumerate all the environ providers which have been registered.
+// RegisteredProviders enumerate all the environ providers which have been
+// registered, in sorted order. Aliases are not included.
 func RegisteredProviders() []string {
 	return GlobalProviderRegistry().RegisteredProviders()
 }
@@ -38,6 +38,17 @@ type dummyProvider struct {
 	environs.EnvironProvider
 }
 
+func (s *suite) TestRegisteredProviders(c *gc.C) {
+	s.PatchValue(environs.Providers, make(map[string]environs.EnvironProvider))
+	s.PatchValue(environs.ProviderAliases, make(map[string]string))
+	environs.RegisterProvider("zebra", &dummyProvider{})
+	environs.RegisterProvider("aardvark", &dummyProvider{}, "anteater")
+	environs.RegisterProvider("mongoose", &dummyProvider{})
+	c.Assert(environs.RegisteredProviders(), jc.DeepEquals, []string{
+		"aardvark", "mongoose", "zebra",
+	})
+}
+
 func (s *suite) TestRegisterProvider(c *gc.C) {
 	s.PatchValue(environs.Providers, make(map[string]environs.EnvironProvider))
 	s.PatchValue(environs.ProviderAliases, make(map[string]string))
@@ -4,8 +4,13 @@
 package environs
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/juju/errors"
 
+	jujucloud "github.com/juju/juju/cloud"
 	"github.com/juju/juju/jujuclient"
 )
 
@@ -14,6 +19,9 @@ const AdminUser = "admin"
 
 // New returns a new environment based on the provided configuration.
 func New(args OpenParams) (Environ, error) {
+	if err := ValidateOpenParams(args); err != nil {
+		return nil, errors.Trace(err)
+	}
 	p, err := Provider(args.Cloud.Type)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -21,6 +29,38 @@ func New(args OpenParams) (Environ, error) {
 	return p.Open(args)
 }
 
+// ValidateOpenParams checks, without contacting the cloud, that the
+// given parameters are complete enough to open an environment: the
+// cloud type must be that of a registered provider, the cloud spec must
+// be well-formed, and a credential with an auth-type supported by the
+// provider must be supplied unless the provider permits none. Passing
+// validation does not mean that Open will succeed; the provider is
+// still responsible for checking endpoints and credential attributes.
+func ValidateOpenParams(args OpenParams) error {
+	p, err := Provider(args.Cloud.Type)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := args.Cloud.Validate(); err != nil {
+		return errors.Annotate(err, "validating cloud spec")
+	}
+	if args.Config == nil {
+		return errors.NotValidf("nil Config")
+	}
+	schemas := p.CredentialSchemas()
+	if args.Cloud.Credential == nil {
+		if _, ok := schemas[jujucloud.EmptyAuthType]; !ok && len(schemas) > 0 {
+			return errors.NotValidf("missing credential for cloud %q", args.Cloud.Name)
+		}
+		return nil
+	}
+	authType := args.Cloud.Credential.AuthType()
+	if _, ok := schemas[authType]; !ok {
+		return errors.NotSupportedf("auth-type %q for cloud %q", authType, args.Cloud.Name)
+	}
+	return nil
+}
+
 // Destroy destroys the controller and, if successful,
 // its associated configuration data from the given store.
 func Destroy(
@@ -44,3 +84,65 @@ func Destroy(
 	}
 	return nil
 }
+
+// DestroyAll destroys each controller in the given store whose details
+// satisfy match, and, if successful, removes its configuration data from
+// the store. The Environ for each controller is obtained by calling
+// getEnviron with the controller's name.
+//
+// If a controller's Environ, or the controller itself, is not found,
+// the controller is assumed to be gone already, and its configuration
+// data is removed. Failing to destroy one controller does not prevent
+// the others from being destroyed; all failures are reported together.
+func DestroyAll(
+	store jujuclient.ControllerStore,
+	match func(controllerName string, details jujuclient.ControllerDetails) bool,
+	getEnviron func(controllerName string) (Environ, error),
+) error {
+	controllers, err := store.AllControllers()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	names := make([]string, 0, len(controllers))
+	for name, details := range controllers {
+		if match(name, details) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var failed []string
+	for _, name := range names {
+		err := destroyController(name, controllers[name], store, getEnviron)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf(
+			"destroying controllers:\n\t%s",
+			strings.Join(failed, "\n\t"),
+		)
+	}
+	return nil
+}
+
+func destroyController(
+	controllerName string,
+	details jujuclient.ControllerDetails,
+	store jujuclient.ControllerStore,
+	getEnviron func(controllerName string) (Environ, error),
+) error {
+	env, err := getEnviron(controllerName)
+	if err == nil {
+		err = env.DestroyController(details.ControllerUUID)
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	err = store.RemoveController(controllerName)
+	if err != nil && !errors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	return nil
+}
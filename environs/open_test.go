@@ -4,12 +4,15 @@
 package environs_test
 
 import (
+	"strings"
+
 	"github.com/juju/errors"
 	gitjujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/juju/cloud"
 	"github.com/juju/juju/environs"
 	"github.com/juju/juju/environs/bootstrap"
 	"github.com/juju/juju/environs/config"
@@ -120,6 +123,81 @@ func (*OpenSuite) TestNewUnknownEnviron(c *gc.C) {
 	c.Assert(env, gc.IsNil)
 }
 
+type credentialsProvider struct {
+	environs.EnvironProvider
+	schemas map[cloud.AuthType]cloud.CredentialSchema
+}
+
+func (p credentialsProvider) CredentialSchemas() map[cloud.AuthType]cloud.CredentialSchema {
+	return p.schemas
+}
+
+func (s *OpenSuite) TestValidateOpenParams(c *gc.C) {
+	s.PatchValue(environs.Providers, make(map[string]environs.EnvironProvider))
+	s.PatchValue(environs.ProviderAliases, make(map[string]string))
+	environs.RegisterProvider("userpass", credentialsProvider{
+		schemas: map[cloud.AuthType]cloud.CredentialSchema{cloud.UserPassAuthType: {}},
+	})
+	environs.RegisterProvider("nocreds", credentialsProvider{
+		schemas: map[cloud.AuthType]cloud.CredentialSchema{cloud.EmptyAuthType: {}},
+	})
+	cfg, err := config.New(config.NoDefaults, dummy.SampleConfig())
+	c.Assert(err, jc.ErrorIsNil)
+	userPass := cloud.NewCredential(cloud.UserPassAuthType, nil)
+	oauth := cloud.NewCredential(cloud.OAuth1AuthType, nil)
+
+	for i, test := range []struct {
+		args environs.OpenParams
+		err  string
+	}{{
+		args: environs.OpenParams{
+			Cloud:  environs.CloudSpec{Type: "userpass", Name: "foo", Credential: &userPass},
+			Config: cfg,
+		},
+	}, {
+		args: environs.OpenParams{
+			Cloud:  environs.CloudSpec{Type: "nocreds", Name: "foo"},
+			Config: cfg,
+		},
+	}, {
+		args: environs.OpenParams{
+			Cloud: environs.CloudSpec{Type: "wondercloud", Name: "foo"},
+		},
+		err: `no registered provider for "wondercloud"`,
+	}, {
+		args: environs.OpenParams{
+			Cloud:  environs.CloudSpec{Type: "userpass", Name: "", Credential: &userPass},
+			Config: cfg,
+		},
+		err: `validating cloud spec: cloud name "" not valid`,
+	}, {
+		args: environs.OpenParams{
+			Cloud: environs.CloudSpec{Type: "userpass", Name: "foo", Credential: &userPass},
+		},
+		err: `nil Config not valid`,
+	}, {
+		args: environs.OpenParams{
+			Cloud:  environs.CloudSpec{Type: "userpass", Name: "foo"},
+			Config: cfg,
+		},
+		err: `missing credential for cloud "foo" not valid`,
+	}, {
+		args: environs.OpenParams{
+			Cloud:  environs.CloudSpec{Type: "userpass", Name: "foo", Credential: &oauth},
+			Config: cfg,
+		},
+		err: `auth-type "oauth1" for cloud "foo" not supported`,
+	}} {
+		c.Logf("test %d", i)
+		err := environs.ValidateOpenParams(test.args)
+		if test.err == "" {
+			c.Check(err, jc.ErrorIsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+		}
+	}
+}
+
 func (*OpenSuite) TestNew(c *gc.C) {
 	cfg, err := config.New(config.NoDefaults, dummy.SampleConfig().Merge(
 		testing.Attrs{
@@ -180,6 +258,47 @@ func (*OpenSuite) TestDestroyNotFound(c *gc.C) {
 	env.CheckCallNames(c) // no controller details, no call
 }
 
+func (*OpenSuite) TestDestroyAll(c *gc.C) {
+	store := jujuclienttesting.NewMemStore()
+	for _, name := range []string{"ci-1", "ci-2", "ci-3", "keep"} {
+		err := store.AddController(name, jujuclient.ControllerDetails{
+			ControllerUUID: name + "-uuid",
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	// ci-1 is destroyed, ci-2 has already gone, and
+	// destroying ci-3 fails.
+	envs := map[string]*destroyControllerEnv{
+		"ci-1": {},
+		"ci-3": {},
+	}
+	envs["ci-3"].SetErrors(errors.New("boom"))
+	getEnviron := func(name string) (environs.Environ, error) {
+		env, ok := envs[name]
+		if !ok {
+			return nil, errors.NotFoundf("model for %q", name)
+		}
+		return env, nil
+	}
+	match := func(name string, details jujuclient.ControllerDetails) bool {
+		return strings.HasPrefix(name, "ci-")
+	}
+	err := environs.DestroyAll(store, match, getEnviron)
+	c.Assert(err, gc.ErrorMatches, "destroying controllers:\n\tci-3: boom")
+
+	envs["ci-1"].CheckCall(c, 0, "DestroyController", "ci-1-uuid")
+	envs["ci-3"].CheckCall(c, 0, "DestroyController", "ci-3-uuid")
+	_, err = store.ControllerByName("ci-1")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	_, err = store.ControllerByName("ci-2")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	_, err = store.ControllerByName("ci-3")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = store.ControllerByName("keep")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
 type destroyControllerEnv struct {
 	environs.Environ
 	gitjujutesting.Stub
@@ -13,7 +13,9 @@ import (
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
 	"github.com/juju/utils"
+	"github.com/juju/utils/arch"
 	jujuseries "github.com/juju/utils/series"
+	"github.com/juju/utils/set"
 	"github.com/juju/version"
 
 	"github.com/juju/juju/environs/filestorage"
@@ -224,6 +226,57 @@ func upload(stor storage.Storage, stream string, forceVersion *version.Number, f
 	return syncBuiltTools(stor, stream, builtTools, fakeSeries...)
 }
 
+// UploadArchesFunc is the type of UploadArches, which may be
+// reassigned to control the behaviour of tools uploading.
+type UploadArchesFunc func(stor storage.Storage, stream string, forceVersion *version.Number, arches []string, series ...string) (coretools.List, error)
+
+// Exported for testing.
+var UploadArches UploadArchesFunc = uploadArches
+
+// uploadArches behaves like upload, but builds and uploads tools for each
+// of the given architectures, returning the tools for each in the order
+// the architectures were given. If no architectures are given, only tools
+// for the host architecture are uploaded, as with upload. Tools for
+// architectures other than the host's are cross-compiled.
+func uploadArches(stor storage.Storage, stream string, forceVersion *version.Number, arches []string, fakeSeries ...string) (coretools.List, error) {
+	if len(arches) == 0 {
+		arches = []string{arch.HostArch()}
+	}
+	var uploaded coretools.List
+	seen := set.NewStrings()
+	for _, toolsArch := range arches {
+		if seen.Contains(toolsArch) {
+			continue
+		}
+		seen.Add(toolsArch)
+		t, err := uploadForArch(stor, stream, forceVersion, toolsArch, fakeSeries...)
+		if err != nil {
+			return nil, errors.Annotatef(err, "uploading %s agent binaries", toolsArch)
+		}
+		uploaded = append(uploaded, t)
+	}
+	return uploaded, nil
+}
+
+// uploadForArch builds and uploads tools for a single architecture,
+// as upload does for the host architecture.
+func uploadForArch(stor storage.Storage, stream string, forceVersion *version.Number, toolsArch string, fakeSeries ...string) (*coretools.Tools, error) {
+	var builtTools *BuiltAgent
+	var err error
+	if toolsArch == arch.HostArch() {
+		builtTools, err = BuildAgentTarball(true, forceVersion, stream)
+	} else {
+		builtTools, err = buildAgentTarballWith(func(w io.Writer) (version.Binary, string, error) {
+			return envtools.BundleToolsForArch(toolsArch, w, forceVersion)
+		}, forceVersion, stream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(builtTools.Dir)
+	return syncBuiltTools(stor, stream, builtTools, fakeSeries...)
+}
+
 // cloneToolsForSeries copies the built tools tarball into a tarball for the specified
 // stream and series and generates corresponding metadata.
 func cloneToolsForSeries(toolsInfo *BuiltAgent, stream string, series ...string) error {
@@ -295,7 +348,18 @@ var BuildAgentTarball BuildAgentTarballFunc = buildAgentTarball
 
 // BuildAgentTarball bundles an agent tarball and places it in a temp directory in
 // the expected agent path.
-func buildAgentTarball(build bool, forceVersion *version.Number, stream string) (_ *BuiltAgent, err error) {
+func buildAgentTarball(build bool, forceVersion *version.Number, stream string) (*BuiltAgent, error) {
+	return buildAgentTarballWith(func(w io.Writer) (version.Binary, string, error) {
+		return envtools.BundleTools(build, w, forceVersion)
+	}, forceVersion, stream)
+}
+
+// buildAgentTarballWith bundles an agent tarball using the given bundle
+// function, and places it in a temp directory in the expected agent path.
+func buildAgentTarballWith(
+	bundle func(io.Writer) (version.Binary, string, error),
+	forceVersion *version.Number, stream string,
+) (_ *BuiltAgent, err error) {
 	// TODO(rog) find binaries from $PATH when not using a development
 	// version of juju within a $GOPATH.
 
@@ -309,7 +373,7 @@ func buildAgentTarball(build bool, forceVersion *version.Number, stream string)
 	}
 	defer f.Close()
 	defer os.Remove(f.Name())
-	toolsVersion, sha256Hash, err := envtools.BundleTools(build, f, forceVersion)
+	toolsVersion, sha256Hash, err := bundle(f)
 	if err != nil {
 		return nil, err
 	}
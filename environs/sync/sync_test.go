@@ -6,6 +6,7 @@ package sync_test
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,6 +25,7 @@ import (
 	"github.com/juju/utils"
 	"github.com/juju/utils/arch"
 	"github.com/juju/utils/series"
+	"github.com/juju/utils/set"
 	"github.com/juju/utils/tar"
 	"github.com/juju/version"
 	gc "gopkg.in/check.v1"
@@ -274,6 +276,60 @@ func (s *uploadSuite) TestUploadFakeSeries(c *gc.C) {
 	s.assertUploadedTools(c, t, []string{seriesToUpload, "quantal", series.MustHostSeries()}, "released")
 }
 
+// patchBundleToolsForArch mocks out cross-building of tools, expecting
+// to be asked only for tools for the given architecture.
+func (s *uploadSuite) patchBundleToolsForArch(c *gc.C, expectArch string) {
+	s.PatchValue(&envtools.BundleToolsForArch, func(toolsArch string, w io.Writer, forceVersion *version.Number) (version.Binary, string, error) {
+		c.Check(toolsArch, gc.Equals, expectArch)
+		vers := version.Binary{
+			Number: jujuversion.Current,
+			Arch:   toolsArch,
+			Series: series.MustHostSeries(),
+		}
+		sha256Hash := fmt.Sprintf("%x", sha256.New().Sum(nil))
+		return vers, sha256Hash, nil
+	})
+}
+
+func (s *uploadSuite) TestUploadArches(c *gc.C) {
+	otherArch := arch.ARM64
+	if otherArch == arch.HostArch() {
+		otherArch = arch.AMD64
+	}
+	s.patchBundleTools(c, nil)
+	s.patchBundleToolsForArch(c, otherArch)
+	arches := []string{otherArch, arch.HostArch(), otherArch}
+	uploaded, err := sync.UploadArches(s.targetStorage, "released", nil, arches, "quantal")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(uploaded, gc.HasLen, 2)
+	c.Check(uploaded[0].Version.Arch, gc.Equals, otherArch)
+	c.Check(uploaded[1].Version.Arch, gc.Equals, arch.HostArch())
+	for _, t := range uploaded {
+		c.Check(t.URL, gc.Not(gc.Equals), "")
+	}
+
+	list, err := envtools.ReadList(s.targetStorage, "released", jujuversion.Current.Major, jujuversion.Current.Minor)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(list.Arches(), jc.SameContents, []string{otherArch, arch.HostArch()})
+	for _, toolsArch := range []string{otherArch, arch.HostArch()} {
+		archList, err := list.Match(coretools.Filter{Arch: toolsArch})
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(archList.AllSeries(), jc.SameContents, set.NewStrings("quantal", series.MustHostSeries()).Values())
+	}
+}
+
+func (s *uploadSuite) TestUploadArchesDefaultsToHostArch(c *gc.C) {
+	s.patchBundleTools(c, nil)
+	s.PatchValue(&envtools.BundleToolsForArch, func(toolsArch string, w io.Writer, forceVersion *version.Number) (version.Binary, string, error) {
+		c.Errorf("unexpected cross-build for %s", toolsArch)
+		return version.Binary{}, "", errors.New("unexpected")
+	})
+	uploaded, err := sync.UploadArches(s.targetStorage, "released", nil, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(uploaded, gc.HasLen, 1)
+	s.assertUploadedTools(c, uploaded[0], []string{series.MustHostSeries()}, "released")
+}
+
 func (s *uploadSuite) TestUploadAndForceVersion(c *gc.C) {
 	vers := jujuversion.Current
 	vers.Patch++
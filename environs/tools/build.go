@@ -17,6 +17,8 @@ import (
 	"strings"
 
 	"github.com/juju/errors"
+	"github.com/juju/utils/arch"
+	"github.com/juju/utils/series"
 	"github.com/juju/version"
 
 	"github.com/juju/juju/juju/names"
@@ -122,6 +124,19 @@ func setenv(env []string, val string) []string {
 	return append(env, val)
 }
 
+// unsetenv returns a copy of env with any entries for the named
+// variable removed. The supplied slice is not modified.
+func unsetenv(env []string, name string) []string {
+	prefix := name + "="
+	result := make([]string, 0, len(env))
+	for _, eval := range env {
+		if !strings.HasPrefix(eval, prefix) {
+			result = append(result, eval)
+		}
+	}
+	return result
+}
+
 func findExecutable(execFile string) (string, error) {
 	logger.Debugf("looking for: %s", execFile)
 	if filepath.IsAbs(execFile) {
@@ -193,12 +208,20 @@ func copyExistingJujud(dir string) error {
 }
 
 func buildJujud(dir string) error {
+	return buildJujudWithEnv(dir, nil)
+}
+
+// buildJujudWithEnv builds jujud into dir, with the given environment
+// variables (in "NAME=value" form) overriding the current environment.
+func buildJujudWithEnv(dir string, extraEnv []string) error {
 	logger.Infof("building jujud")
 	cmds := [][]string{
 		{"go", "build", "-gccgoflags=-static-libgo", "-o", filepath.Join(dir, names.Jujud), "github.com/juju/juju/cmd/jujud"},
 	}
+	env := buildEnv(os.Environ(), extraEnv)
 	for _, args := range cmds {
 		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Env = env
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			return fmt.Errorf("build command %q failed: %v; %s", args[0], err, out)
@@ -207,6 +230,20 @@ func buildJujud(dir string) error {
 	return nil
 }
 
+// buildEnv returns the environment in which to build jujud, given the
+// current environment and the variables that override it. Any GOOS or
+// GOARCH in the current environment is dropped: jujud is built for the
+// host unless the overrides say otherwise, because a jujud built for
+// the host is run to find out its version.
+func buildEnv(env, extraEnv []string) []string {
+	env = unsetenv(env, "GOOS")
+	env = unsetenv(env, "GOARCH")
+	for _, val := range extraEnv {
+		env = setenv(env, val)
+	}
+	return env
+}
+
 func packageLocalTools(toolsDir string, buildAgent bool) error {
 	if !buildAgent {
 		if err := copyExistingJujud(toolsDir); err != nil {
@@ -250,18 +287,78 @@ func bundleTools(build bool, w io.Writer, forceVersion *version.Number) (tvers v
 		return version.Binary{}, "", errors.Trace(err)
 	}
 
+	sha256hash, err := archiveToolsDir(w, dir, forceVersion)
+	if err != nil {
+		return version.Binary{}, "", err
+	}
+	return tvers, sha256hash, err
+}
+
+// archiveToolsDir writes the tools in dir to w as bundleTools does,
+// including a FORCE-VERSION file if forceVersion is not nil, and
+// returns a hex-encoded SHA256 hash of the resulting archive.
+func archiveToolsDir(w io.Writer, dir string, forceVersion *version.Number) (string, error) {
 	if forceVersion != nil {
 		logger.Debugf("forcing version to %s", forceVersion)
 		if err := ioutil.WriteFile(filepath.Join(dir, "FORCE-VERSION"), []byte(forceVersion.String()), 0666); err != nil {
-			return version.Binary{}, "", err
+			return "", err
 		}
 	}
+	return archiveAndSHA256(w, dir)
+}
+
+// goArches maps the names of the architectures that agent binaries
+// may be built for to the corresponding values of GOARCH.
+var goArches = map[string]string{
+	arch.AMD64:   "amd64",
+	arch.I386:    "386",
+	arch.ARM:     "arm",
+	arch.ARM64:   "arm64",
+	arch.PPC64EL: "ppc64le",
+	arch.S390X:   "s390x",
+}
+
+// BundleToolsForArchFunc is a function which can build the juju tools
+// for a given architecture and bundle them in gzipped tar format to the
+// given writer.
+type BundleToolsForArchFunc func(toolsArch string, w io.Writer, forceVersion *version.Number) (version.Binary, string, error)
+
+// Override for testing.
+var BundleToolsForArch BundleToolsForArchFunc = bundleToolsForArch
+
+// bundleToolsForArch builds the juju tools from source for the given
+// architecture, and bundles them as bundleTools does. A binary built
+// for another architecture cannot be run to ask it its version, so the
+// tools are assumed to have the version of this client.
+func bundleToolsForArch(toolsArch string, w io.Writer, forceVersion *version.Number) (version.Binary, string, error) {
+	goarch, ok := goArches[toolsArch]
+	if !ok {
+		return version.Binary{}, "", errors.NotSupportedf("building agent binaries for architecture %q", toolsArch)
+	}
+	hostSeries, err := series.HostSeries()
+	if err != nil {
+		return version.Binary{}, "", errors.Trace(err)
+	}
+	dir, err := ioutil.TempDir("", "juju-tools")
+	if err != nil {
+		return version.Binary{}, "", err
+	}
+	defer os.RemoveAll(dir)
 
-	sha256hash, err := archiveAndSHA256(w, dir)
+	logger.Infof("Building %s agent binary to upload (%s)", toolsArch, jujuversion.Current.String())
+	if err := buildJujudWithEnv(dir, []string{"GOARCH=" + goarch}); err != nil {
+		return version.Binary{}, "", errors.Annotatef(err, "cannot build %s jujud agent binary from source", toolsArch)
+	}
+	tvers := version.Binary{
+		Number: jujuversion.Current,
+		Series: hostSeries,
+		Arch:   toolsArch,
+	}
+	sha256hash, err := archiveToolsDir(w, dir, forceVersion)
 	if err != nil {
 		return version.Binary{}, "", err
 	}
-	return tvers, sha256hash, err
+	return tvers, sha256hash, nil
 }
 
 var execCommand = exec.Command
@@ -212,3 +212,10 @@ func (b *buildSuite) TestGetVersionFromJujudWithRunError(c *gc.C) {
 		c.Fatalf("Failed to get args sent to executable.")
 	}
 }
+
+func (b *buildSuite) TestBundleToolsForArchUnsupported(c *gc.C) {
+	var buf bytes.Buffer
+	_, _, err := tools.BundleToolsForArch("mips", &buf, nil)
+	c.Assert(err, gc.ErrorMatches, `building agent binaries for architecture "mips" not supported`)
+	c.Assert(buf.Len(), gc.Equals, 0)
+}
@@ -5,6 +5,8 @@ package tools
 
 var (
 	Setenv                        = setenv
+	Unsetenv                      = unsetenv
+	BuildEnv                      = buildEnv
 	FindExecutable                = findExecutable
 	CheckToolsSeries              = checkToolsSeries
 	ArchiveAndSHA256              = archiveAndSHA256
@@ -13,4 +15,5 @@ var (
 	MarshalToolsMetadataIndexJSON = marshalToolsMetadataIndexJSON
 	GetVersionFromJujud           = getVersionFromJujud
 	ExecCommand                   = &execCommand
+	MergeToolsLists               = mergeToolsLists
 )
@@ -252,17 +252,22 @@ type MetadataFile struct {
 
 // MetadataFromTools returns a tools metadata list derived from the
 // given tools list. The size and sha256 will not be computed if
-// missing.
+// missing. Tools whose URL names an xz-compressed tarball are
+// described as such; all others are assumed to be gzipped.
 func MetadataFromTools(toolsList coretools.List, toolsDir string) []*ToolsMetadata {
 	metadata := make([]*ToolsMetadata, len(toolsList))
 	for i, t := range toolsList {
-		path := fmt.Sprintf("%s/juju-%s-%s-%s.tgz", toolsDir, t.Version.Number, t.Version.Series, t.Version.Arch)
+		suffix, fileType := toolSuffix, "tar.gz"
+		if strings.HasSuffix(t.URL, toolSuffixXZ) {
+			suffix, fileType = toolSuffixXZ, "tar.xz"
+		}
+		path := fmt.Sprintf("%s/juju-%s-%s-%s%s", toolsDir, t.Version.Number, t.Version.Series, t.Version.Arch, suffix)
 		metadata[i] = &ToolsMetadata{
 			Release:  t.Version.Series,
 			Version:  t.Version.Number.String(),
 			Arch:     t.Version.Arch,
 			Path:     path,
-			FileType: "tar.gz",
+			FileType: fileType,
 			Size:     t.Size,
 			SHA256:   t.SHA256,
 		}
@@ -516,10 +521,50 @@ func MergeAndWriteMetadata(stor storage.Storage, toolsDir, stream string, tools
 	return WriteMetadata(stor, existing, []string{stream}, writeMirrors)
 }
 
+// AppendAndWriteMetadata reads the existing metadata from storage (if any),
+// and adds metadata generated from those of the given tools whose versions
+// are not already in the stream. Unlike MergeAndWriteMetadata, existing
+// entries are neither replaced nor checked against the given tools, and
+// if there is nothing new to add then nothing is written. This keeps
+// publishing a new tools build cheap for streams with many versions.
+func AppendAndWriteMetadata(stor storage.Storage, toolsDir, stream string, tools coretools.List, writeMirrors ShouldWriteMirrors) error {
+	existing, err := ReadAllMetadata(stor)
+	if err != nil {
+		return err
+	}
+	known := make(map[version.Binary]bool)
+	for _, tm := range existing[stream] {
+		binary, err := tm.binary()
+		if err != nil {
+			return errors.Annotate(err, "cannot append metadata")
+		}
+		known[binary] = true
+	}
+	var added coretools.List
+	for _, t := range tools {
+		if known[t.Version] {
+			continue
+		}
+		known[t.Version] = true
+		added = append(added, t)
+	}
+	if len(added) == 0 {
+		logger.Infof("No new tools for stream %q", stream)
+		return nil
+	}
+	existing[stream] = append(existing[stream], MetadataFromTools(added, toolsDir)...)
+	return WriteMetadata(stor, existing, []string{stream}, writeMirrors)
+}
+
 // fetchToolsHash fetches the tools from storage and calculates
 // its size in bytes and computes a SHA256 hash of its contents.
+// If there is no gzipped tarball for the tools, an xz-compressed
+// one is used instead.
 func fetchToolsHash(stor storage.StorageReader, stream string, ver version.Binary) (size int64, sha256hash hash.Hash, err error) {
 	r, err := storage.Get(stor, StorageName(ver, stream))
+	if errors.IsNotFound(err) {
+		r, err = storage.Get(stor, StorageNameXZ(ver, stream))
+	}
 	if err != nil {
 		return 0, nil, err
 	}
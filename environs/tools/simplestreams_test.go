@@ -459,6 +459,66 @@ func (s *simplestreamsSuite) TestWriteMetadataMergeWithExisting(c *gc.C) {
 	assertMetadataMatches(c, dir, "devel", newToolsList, metadata)
 }
 
+// putCountingStorage is a storage.Storage that counts calls to Put.
+type putCountingStorage struct {
+	storage.Storage
+	puts int
+}
+
+func (s *putCountingStorage) Put(name string, r io.Reader, length int64) error {
+	s.puts++
+	return s.Storage.Put(name, r, length)
+}
+
+func (s *simplestreamsSuite) TestAppendAndWriteMetadata(c *gc.C) {
+	dir := c.MkDir()
+	existingToolsList := coretools.List{
+		{
+			Version: version.MustParseBinary("1.2.3-precise-amd64"),
+			Size:    123,
+			SHA256:  "abc",
+		}, {
+			Version: version.MustParseBinary("2.0.1-raring-amd64"),
+			Size:    456,
+			SHA256:  "xyz",
+		},
+	}
+	writer, err := filestorage.NewFileStorageWriter(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	stor := &putCountingStorage{Storage: writer}
+	err = tools.AppendAndWriteMetadata(stor, "testing", "testing", existingToolsList, tools.DoNotWriteMirrors)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stor.puts, gc.Not(gc.Equals), 0)
+
+	// Existing versions are left alone, even if the given
+	// tools disagree with them; new versions are added once.
+	newTools := &coretools.Tools{
+		Version: version.MustParseBinary("2.1.0-raring-amd64"),
+		Size:    789,
+		SHA256:  "def",
+	}
+	newToolsList := coretools.List{
+		{
+			Version: existingToolsList[0].Version,
+			Size:    999,
+			SHA256:  "changed",
+		},
+		newTools,
+		newTools,
+	}
+	err = tools.AppendAndWriteMetadata(stor, "testing", "testing", newToolsList, tools.DoNotWriteMirrors)
+	c.Assert(err, jc.ErrorIsNil)
+	requiredToolsList := append(existingToolsList, newTools)
+	metadata := toolstesting.ParseMetadataFromDir(c, dir, "testing", false)
+	assertMetadataMatches(c, dir, "testing", requiredToolsList, metadata)
+
+	// Nothing is written when there is nothing new.
+	stor.puts = 0
+	err = tools.AppendAndWriteMetadata(stor, "testing", "testing", requiredToolsList, tools.DoNotWriteMirrors)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stor.puts, gc.Equals, 0)
+}
+
 type productSpecSuite struct{}
 
 var _ = gc.Suite(&productSpecSuite{})
@@ -628,6 +688,19 @@ func (*metadataHelperSuite) TestMetadataFromTools(c *gc.C) {
 	}
 }
 
+func (*metadataHelperSuite) TestMetadataFromToolsXZ(c *gc.C) {
+	vers := version.MustParseBinary("2.0.1-raring-amd64")
+	metadata := tools.MetadataFromTools(coretools.List{{
+		Version: vers,
+		URL:     "file:///tmp/proposed/juju-2.0.1-raring-amd64.tar.xz",
+		Size:    456,
+		SHA256:  "xyz",
+	}}, "proposed")
+	c.Assert(metadata, gc.HasLen, 1)
+	c.Assert(metadata[0].Path, gc.Equals, tools.StorageNameXZ(vers, "proposed")[len("tools/"):])
+	c.Assert(metadata[0].FileType, gc.Equals, "tar.xz")
+}
+
 type countingStorage struct {
 	storage.StorageReader
 	counter int
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/juju/utils/arch"
 	"github.com/juju/version"
@@ -19,8 +20,9 @@ import (
 var ErrNoTools = errors.New("no tools available")
 
 const (
-	toolPrefix = "tools/%s/juju-"
-	toolSuffix = ".tgz"
+	toolPrefix   = "tools/%s/juju-"
+	toolSuffix   = ".tgz"
+	toolSuffixXZ = ".tar.xz"
 )
 
 // StorageName returns the name that is used to store and retrieve the
@@ -29,13 +31,55 @@ func StorageName(vers version.Binary, stream string) string {
 	return storagePrefix(stream) + vers.String() + toolSuffix
 }
 
+// StorageNameXZ returns the name that is used to store and retrieve the
+// given version of the juju tools when they are compressed with xz rather
+// than gzip.
+func StorageNameXZ(vers version.Binary, stream string) string {
+	return storagePrefix(stream) + vers.String() + toolSuffixXZ
+}
+
 func storagePrefix(stream string) string {
 	return fmt.Sprintf(toolPrefix, stream)
 }
 
+// trimToolSuffix returns name without its tools tarball suffix,
+// and whether it had one.
+func trimToolSuffix(name string) (string, bool) {
+	for _, suffix := range []string{toolSuffix, toolSuffixXZ} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return name, false
+}
+
+// ParseStorageName returns the version of the juju tools stored with the
+// given name, which must be of the form returned by StorageName or
+// StorageNameXZ for some stream.
+func ParseStorageName(name string) (version.Binary, error) {
+	name = filepath.ToSlash(name)
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) == 3 && parts[1] != "" {
+		prefix := storagePrefix(parts[1])
+		if trimmed, ok := trimToolSuffix(name); ok && strings.HasPrefix(name, prefix) {
+			vers, err := version.ParseBinary(trimmed[len(prefix):])
+			if err != nil {
+				return version.Binary{}, fmt.Errorf("invalid tools storage name %q: %v", name, err)
+			}
+			return vers, nil
+		}
+	}
+	return version.Binary{}, fmt.Errorf(
+		"invalid tools storage name %q: expected %q",
+		name, storagePrefix("<stream>")+"<version>"+toolSuffix,
+	)
+}
+
 // ReadList returns a List of the tools in store with the given major.minor version.
 // If minorVersion = -1, then only majorVersion is considered.
 // If majorVersion is -1, then all tools tarballs are used.
+// Tarballs compressed with either gzip or xz are recognised; where both
+// exist for the same version, the gzipped tarball is used.
 // If store contains no such tools, it returns ErrNoMatches.
 func ReadList(stor storage.StorageReader, toolsDir string, majorVersion, minorVersion int) (coretools.List, error) {
 	if minorVersion >= 0 {
@@ -48,20 +92,31 @@ func ReadList(stor storage.StorageReader, toolsDir string, majorVersion, minorVe
 	if err != nil {
 		return nil, err
 	}
-	var list coretools.List
-	var foundAnyTools bool
+	var versions []version.Binary
+	versionNames := make(map[version.Binary]string)
 	for _, name := range names {
 		name = filepath.ToSlash(name)
-		if !strings.HasPrefix(name, storagePrefix) || !strings.HasSuffix(name, toolSuffix) {
+		if _, ok := trimToolSuffix(name); !ok || !strings.HasPrefix(name, storagePrefix) {
 			continue
 		}
-		var t coretools.Tools
-		vers := name[len(storagePrefix) : len(name)-len(toolSuffix)]
-		if t.Version, err = version.ParseBinary(vers); err != nil {
-			logger.Debugf("failed to parse version %q: %v", vers, err)
+		vers, err := ParseStorageName(name)
+		if err != nil {
+			logger.Debugf("%v", err)
 			continue
 		}
-		foundAnyTools = true
+		existing, ok := versionNames[vers]
+		if !ok {
+			versions = append(versions, vers)
+		}
+		if !ok || strings.HasSuffix(existing, toolSuffixXZ) {
+			versionNames[vers] = name
+		}
+	}
+	var list coretools.List
+	foundAnyTools := len(versions) > 0
+	for _, vers := range versions {
+		name := versionNames[vers]
+		t := coretools.Tools{Version: vers}
 		// If specified major version value supplied, major version must match.
 		if majorVersion >= 0 && t.Version.Major != majorVersion {
 			continue
@@ -70,7 +125,7 @@ func ReadList(stor storage.StorageReader, toolsDir string, majorVersion, minorVe
 		if minorVersion >= 0 && t.Version.Minor != minorVersion {
 			continue
 		}
-		logger.Debugf("found %s", vers)
+		logger.Debugf("found %s", t.Version)
 		if t.URL, err = stor.URL(name); err != nil {
 			return nil, err
 		}
@@ -90,3 +145,75 @@ func ReadList(stor storage.StorageReader, toolsDir string, majorVersion, minorVe
 	}
 	return list, nil
 }
+
+// ReadListMulti returns a List of the tools in the given storage sources,
+// as ReadList does for a single source. The sources are read concurrently,
+// and their tools merged so that each version appears only once. Where
+// several sources have the same version, the tools from the earliest
+// source are used, unless only a later source reports a checksum.
+//
+// Sources that cannot be read are skipped so long as some other source
+// can be. If no source has any tools, ErrNoTools is returned; if none has
+// tools matching the requested version, coretools.ErrNoMatches is
+// returned.
+func ReadListMulti(sources []storage.StorageReader, toolsDir string, majorVersion, minorVersion int) (coretools.List, error) {
+	lists := make([]coretools.List, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, stor := range sources {
+		wg.Add(1)
+		go func(i int, stor storage.StorageReader) {
+			defer wg.Done()
+			lists[i], errs[i] = ReadList(stor, toolsDir, majorVersion, minorVersion)
+		}(i, stor)
+	}
+	wg.Wait()
+
+	var readErr error
+	var foundAnyTools bool
+	for i, err := range errs {
+		switch err {
+		case nil, ErrNoTools:
+		case coretools.ErrNoMatches:
+			foundAnyTools = true
+		default:
+			logger.Debugf("cannot read tools from source %d: %v", i, err)
+			if readErr == nil {
+				readErr = err
+			}
+		}
+	}
+	list := mergeToolsLists(lists)
+	if len(list) > 0 {
+		return list, nil
+	}
+	if foundAnyTools {
+		return nil, coretools.ErrNoMatches
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return nil, ErrNoTools
+}
+
+// mergeToolsLists returns the tools in the given lists, with duplicate
+// versions removed. The first tools for each version are kept, unless
+// they have no checksum and later tools for that version do.
+func mergeToolsLists(lists []coretools.List) coretools.List {
+	var merged coretools.List
+	indices := make(map[version.Binary]int)
+	for _, list := range lists {
+		for _, t := range list {
+			i, ok := indices[t.Version]
+			if !ok {
+				indices[t.Version] = len(merged)
+				merged = append(merged, t)
+				continue
+			}
+			if merged[i].SHA256 == "" && t.SHA256 != "" {
+				merged[i] = t
+			}
+		}
+	}
+	return merged
+}
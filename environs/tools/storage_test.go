@@ -4,11 +4,17 @@
 package tools_test
 
 import (
+	"errors"
+	"io"
+	"strings"
+
 	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
 	"github.com/juju/version"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/juju/environs/filestorage"
+	"github.com/juju/juju/environs/storage"
 	envtesting "github.com/juju/juju/environs/testing"
 	envtools "github.com/juju/juju/environs/tools"
 	coretesting "github.com/juju/juju/testing"
@@ -27,6 +33,41 @@ func (s *StorageSuite) TestStorageName(c *gc.C) {
 	c.Assert(path, gc.Equals, "tools/proposed/juju-1.2.3-precise-amd64.tgz")
 }
 
+func (s *StorageSuite) TestStorageNameXZ(c *gc.C) {
+	vers := version.MustParseBinary("1.2.3-precise-amd64")
+	path := envtools.StorageNameXZ(vers, "proposed")
+	c.Assert(path, gc.Equals, "tools/proposed/juju-1.2.3-precise-amd64.tar.xz")
+}
+
+func (s *StorageSuite) TestParseStorageName(c *gc.C) {
+	vers := version.MustParseBinary("1.2.3-precise-amd64")
+	for _, stream := range []string{"released", "proposed", "devel"} {
+		parsed, err := envtools.ParseStorageName(envtools.StorageName(vers, stream))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(parsed, gc.Equals, vers)
+
+		parsed, err = envtools.ParseStorageName(envtools.StorageNameXZ(vers, stream))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(parsed, gc.Equals, vers)
+	}
+}
+
+func (s *StorageSuite) TestParseStorageNameInvalid(c *gc.C) {
+	for _, name := range []string{
+		"",
+		"tools/juju-1.2.3-precise-amd64.tgz",
+		"tools//juju-1.2.3-precise-amd64.tgz",
+		"tools/released/juju-1.2.3-precise-amd64.tar.gz",
+		"tools/released/jujud-1.2.3-precise-amd64.tgz",
+		"other/released/juju-1.2.3-precise-amd64.tgz",
+	} {
+		_, err := envtools.ParseStorageName(name)
+		c.Check(err, gc.ErrorMatches, `invalid tools storage name ".*": expected "tools/<stream>/juju-<version>.tgz"`)
+	}
+	_, err := envtools.ParseStorageName("tools/released/juju-1.2.3.tgz")
+	c.Assert(err, gc.ErrorMatches, `invalid tools storage name "tools/released/juju-1.2.3.tgz": invalid binary version "1.2.3"`)
+}
+
 func (s *StorageSuite) TestReadListEmpty(c *gc.C) {
 	stor, err := filestorage.NewFileStorageWriter(c.MkDir())
 	c.Assert(err, jc.ErrorIsNil)
@@ -104,6 +145,119 @@ func (s *StorageSuite) TestReadListLegacyPPC64(c *gc.C) {
 	c.Assert(list, gc.DeepEquals, expected)
 }
 
+func (s *StorageSuite) TestReadListXZ(c *gc.C) {
+	stor, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	v100 := version.MustParseBinary("1.0.0-precise-amd64")
+	v101 := version.MustParseBinary("1.0.1-precise-amd64")
+	// 1.0.0 is available only as xz; 1.0.1 is available as both,
+	// in which case the gzipped tarball is preferred.
+	for _, name := range []string{
+		envtools.StorageNameXZ(v100, "proposed"),
+		envtools.StorageNameXZ(v101, "proposed"),
+		envtools.StorageName(v101, "proposed"),
+	} {
+		err := stor.Put(name, strings.NewReader("tarball"), 7)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	list, err := envtools.ReadList(stor, "proposed", 1, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(list, gc.HasLen, 2)
+	c.Check(list[0].Version, gc.Equals, v100)
+	c.Check(strings.HasSuffix(list[0].URL, "juju-1.0.0-precise-amd64.tar.xz"), jc.IsTrue)
+	c.Check(list[1].Version, gc.Equals, v101)
+	c.Check(strings.HasSuffix(list[1].URL, "juju-1.0.1-precise-amd64.tgz"), jc.IsTrue)
+}
+
+func (s *StorageSuite) TestReadListMulti(c *gc.C) {
+	primary, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	mirror, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	v100 := version.MustParseBinary("1.0.0-precise-amd64")
+	v101 := version.MustParseBinary("1.0.1-precise-amd64")
+	v111 := version.MustParseBinary("1.1.1-precise-amd64")
+	primaryTools := envtesting.AssertUploadFakeToolsVersions(c, primary, "proposed", "proposed", v100, v101)
+	mirrorTools := envtesting.AssertUploadFakeToolsVersions(c, mirror, "proposed", "proposed", v101, v111)
+	// ReadList doesn't set the Size or SHA256, so blank out those attributes.
+	for _, tool := range append(primaryTools, mirrorTools...) {
+		tool.Size = 0
+		tool.SHA256 = ""
+	}
+
+	sources := []storage.StorageReader{primary, mirror}
+	list, err := envtools.ReadListMulti(sources, "proposed", 1, -1)
+	c.Assert(err, jc.ErrorIsNil)
+	// v101 comes from the primary source, which is listed first.
+	c.Assert(list, gc.DeepEquals, coretools.List{primaryTools[0], primaryTools[1], mirrorTools[1]})
+
+	list, err = envtools.ReadListMulti(sources, "proposed", 1, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(list, gc.DeepEquals, coretools.List{mirrorTools[1]})
+
+	_, err = envtools.ReadListMulti(sources, "proposed", 2, -1)
+	c.Assert(err, gc.Equals, coretools.ErrNoMatches)
+}
+
+func (s *StorageSuite) TestReadListMultiSourceUnavailable(c *gc.C) {
+	stor, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	v100 := version.MustParseBinary("1.0.0-precise-amd64")
+	agentTools := envtesting.AssertUploadFakeToolsVersions(c, stor, "proposed", "proposed", v100)
+	agentTools[0].Size = 0
+	agentTools[0].SHA256 = ""
+
+	broken := failingStorageReader{errors.New("mirror is down")}
+	list, err := envtools.ReadListMulti([]storage.StorageReader{broken, stor}, "proposed", 1, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(list, gc.DeepEquals, coretools.List(agentTools))
+
+	_, err = envtools.ReadListMulti([]storage.StorageReader{broken}, "proposed", 1, 0)
+	c.Assert(err, gc.ErrorMatches, "mirror is down")
+}
+
+func (s *StorageSuite) TestReadListMultiEmpty(c *gc.C) {
+	stor, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = envtools.ReadListMulti([]storage.StorageReader{stor, stor}, "released", 2, 0)
+	c.Assert(err, gc.Equals, envtools.ErrNoTools)
+}
+
+func (s *StorageSuite) TestMergeToolsListsPrefersChecksums(c *gc.C) {
+	vers := version.MustParseBinary("1.0.0-precise-amd64")
+	withoutChecksum := &coretools.Tools{Version: vers, URL: "primary"}
+	withChecksum := &coretools.Tools{Version: vers, URL: "mirror", SHA256: "abc"}
+	merged := envtools.MergeToolsLists([]coretools.List{{withoutChecksum}, {withChecksum}})
+	c.Assert(merged, gc.DeepEquals, coretools.List{withChecksum})
+}
+
+// failingStorageReader is a storage.StorageReader whose
+// List method always fails.
+type failingStorageReader struct {
+	err error
+}
+
+func (r failingStorageReader) Get(name string) (io.ReadCloser, error) {
+	return nil, r.err
+}
+
+func (r failingStorageReader) List(prefix string) ([]string, error) {
+	return nil, r.err
+}
+
+func (r failingStorageReader) URL(name string) (string, error) {
+	return "", r.err
+}
+
+func (r failingStorageReader) DefaultConsistencyStrategy() utils.AttemptStrategy {
+	return utils.AttemptStrategy{}
+}
+
+func (r failingStorageReader) ShouldRetry(err error) bool {
+	return false
+}
+
 var setenvTests = []struct {
 	set    string
 	expect []string
@@ -124,3 +278,38 @@ func (*StorageSuite) TestSetenv(c *gc.C) {
 		c.Check(env, gc.DeepEquals, t.expect)
 	}
 }
+
+var unsetenvTests = []struct {
+	unset  string
+	expect []string
+}{
+	{"foo", []string{"arble="}},
+	{"arble", []string{"foo=bar"}},
+	{"zaphod", []string{"foo=bar", "arble="}},
+	{"fo", []string{"foo=bar", "arble="}},
+}
+
+func (*StorageSuite) TestUnsetenv(c *gc.C) {
+	env0 := []string{"foo=bar", "arble="}
+	for i, t := range unsetenvTests {
+		c.Logf("test %d", i)
+		env := make([]string, len(env0))
+		copy(env, env0)
+		env = envtools.Unsetenv(env, t.unset)
+		c.Check(env, gc.DeepEquals, t.expect)
+	}
+}
+
+func (*StorageSuite) TestUnsetenvLeavesInputUnchanged(c *gc.C) {
+	env := []string{"foo=bar", "arble=", "baz=qux"}
+	result := envtools.Unsetenv(env, "foo")
+	c.Check(result, gc.DeepEquals, []string{"arble=", "baz=qux"})
+	c.Check(env, gc.DeepEquals, []string{"foo=bar", "arble=", "baz=qux"})
+}
+
+func (*StorageSuite) TestBuildEnv(c *gc.C) {
+	env := []string{"GOOS=windows", "PATH=/bin", "GOARCH=arm64"}
+	c.Check(envtools.BuildEnv(env, nil), gc.DeepEquals, []string{"PATH=/bin"})
+	c.Check(envtools.BuildEnv(env, []string{"GOARCH=s390x"}), gc.DeepEquals, []string{"PATH=/bin", "GOARCH=s390x"})
+	c.Check(env, gc.DeepEquals, []string{"GOOS=windows", "PATH=/bin", "GOARCH=arm64"})
+}
@@ -16,6 +16,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
 	"github.com/juju/utils/arch"
@@ -149,25 +150,13 @@ func ParseMetadataFromDir(c *gc.C, metadataDir, stream string, expectMirrors boo
 // ParseMetadataFromStorage loads ToolsMetadata from the specified storage reader.
 func ParseMetadataFromStorage(c *gc.C, stor storage.StorageReader, stream string, expectMirrors bool) []*tools.ToolsMetadata {
 	source := storage.NewStorageSimpleStreamsDataSource("test storage reader", stor, "tools", simplestreams.CUSTOM_CLOUD_DATA, false)
-	params := simplestreams.ValueParams{
-		DataType:      tools.ContentDownload,
-		ValueTemplate: tools.ToolsMetadata{},
-	}
-
-	const requireSigned = false
-	indexPath := simplestreams.UnsignedIndex("v1", 2)
-	mirrorsPath := simplestreams.MirrorsPath("v1")
-	indexRef, err := simplestreams.GetIndexWithFormat(
-		source, indexPath, "index:1.0", mirrorsPath, requireSigned, simplestreams.CloudSpec{}, params)
+	toolsIndexMetadata, err := readToolsIndexMetadata(source, stream)
 	c.Assert(err, jc.ErrorIsNil)
 
-	toolsIndexMetadata := indexRef.Indexes[tools.ToolsContentId(stream)]
-	c.Assert(toolsIndexMetadata, gc.NotNil)
-
 	// Read the products file contents.
 	r, err := stor.Get(path.Join("tools", toolsIndexMetadata.ProductsFilePath))
-	defer r.Close()
 	c.Assert(err, jc.ErrorIsNil)
+	defer r.Close()
 	data, err := ioutil.ReadAll(r)
 	c.Assert(err, jc.ErrorIsNil)
 
@@ -217,6 +206,45 @@ func ParseMetadataFromStorage(c *gc.C, stor storage.StorageReader, stream string
 	return toolsMetadata
 }
 
+// readToolsIndexMetadata reads the unsigned tools index from the given
+// source, and returns the metadata for the specified stream. If the index
+// has no such stream, the error names the streams it does have.
+func readToolsIndexMetadata(source simplestreams.DataSource, stream string) (*simplestreams.IndexMetadata, error) {
+	params := simplestreams.ValueParams{
+		DataType:      tools.ContentDownload,
+		ValueTemplate: tools.ToolsMetadata{},
+	}
+	const requireSigned = false
+	indexPath := simplestreams.UnsignedIndex("v1", 2)
+	mirrorsPath := simplestreams.MirrorsPath("v1")
+	indexRef, err := simplestreams.GetIndexWithFormat(
+		source, indexPath, "index:1.0", mirrorsPath, requireSigned, simplestreams.CloudSpec{}, params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	toolsIndexMetadata, ok := indexRef.Indexes[tools.ToolsContentId(stream)]
+	if !ok {
+		return nil, errors.Errorf(
+			"tools index has no %q stream (found %s)", stream, strings.Join(indexStreams(indexRef), ", "),
+		)
+	}
+	return toolsIndexMetadata, nil
+}
+
+// indexStreams returns the sorted names of the tools streams
+// referenced by the given index.
+func indexStreams(indexRef *simplestreams.IndexReference) []string {
+	const prefix = "com.ubuntu.juju:"
+	const suffix = ":tools"
+	streams := make(set.Strings)
+	for id := range indexRef.Indexes {
+		if strings.HasPrefix(id, prefix) && strings.HasSuffix(id, suffix) {
+			streams.Add(id[len(prefix) : len(id)-len(suffix)])
+		}
+	}
+	return streams.SortedValues()
+}
+
 type metadataFile struct {
 	path string
 	data []byte
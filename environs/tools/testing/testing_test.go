@@ -0,0 +1,45 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/environs/filestorage"
+	"github.com/juju/juju/environs/simplestreams"
+	"github.com/juju/juju/environs/storage"
+	"github.com/juju/juju/environs/tools"
+	coretesting "github.com/juju/juju/testing"
+)
+
+type metadataSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&metadataSuite{})
+
+func (s *metadataSuite) source(c *gc.C, stream string) simplestreams.DataSource {
+	dir := c.MkDir()
+	UploadToDirectory(c, stream, filepath.Join(dir, "tools"), version.MustParseBinary("2.0.0-trusty-amd64"))
+	stor, err := filestorage.NewFileStorageReader(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	return storage.NewStorageSimpleStreamsDataSource("test storage reader", stor, "tools", simplestreams.CUSTOM_CLOUD_DATA, false)
+}
+
+func (s *metadataSuite) TestReadToolsIndexMetadata(c *gc.C) {
+	source := s.source(c, "released")
+	metadata, err := readToolsIndexMetadata(source, "released")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(metadata.ProductsFilePath, gc.Equals, tools.ProductMetadataPath("released"))
+}
+
+func (s *metadataSuite) TestReadToolsIndexMetadataMissingStream(c *gc.C) {
+	source := s.source(c, "released")
+	_, err := readToolsIndexMetadata(source, "devel")
+	c.Assert(err, gc.ErrorMatches, `tools index has no "devel" stream \(found released\)`)
+}
@@ -90,6 +90,8 @@ func (s *cmdControllerSuite) TestCreateModelAdminUser(c *gc.C) {
 		"Model        Cloud/Region        Status     Access  Last connection\n"+
 		"controller*  dummy/dummy-region  available  admin   just now\n"+
 		"new-model    dummy/dummy-region  available  admin   never connected\n"+
+		"\n"+
+		"2 models\n"+
 		"\n")
 }
 
@@ -102,6 +104,8 @@ func (s *cmdControllerSuite) TestAddModelNormalUser(c *gc.C) {
 		"Model              Cloud/Region        Status     Access  Last connection\n"+
 		"admin/controller*  dummy/dummy-region  available  admin   just now\n"+
 		"test/new-model     dummy/dummy-region  available          never connected\n"+
+		"\n"+
+		"2 models\n"+
 		"\n")
 }
 
@@ -135,6 +139,7 @@ models:
     "1":
       cores: 2
 current-model: controller
+model-count: 1
 `[1:])
 }
 
@@ -165,6 +170,8 @@ func (s *cmdControllerSuite) TestListDeadModels(c *gc.C) {
 		"Model        Cloud/Region        Status      Access  Last connection\n"+
 		"controller*  dummy/dummy-region  available   admin   just now\n"+
 		"new-model    dummy/dummy-region  destroying  admin   never connected\n"+
+		"\n"+
+		"2 models\n"+
 		"\n")
 }
 
@@ -104,6 +104,7 @@ type azureEnviron struct {
 	mu                     sync.Mutex
 	config                 *azureModelConfig
 	instanceTypes          map[string]instances.InstanceType
+	maxDataDiskCounts      map[string]int32
 	storageAccount         *storage.Account
 	storageAccountKey      *storage.AccountKey
 	commonResourcesCreated bool
@@ -1638,10 +1639,14 @@ func (env *azureEnviron) getInstanceTypesLocked() (map[string]instances.Instance
 		return nil, errors.Annotate(err, "listing VM sizes")
 	}
 	instanceTypes := make(map[string]instances.InstanceType)
+	maxDataDiskCounts := make(map[string]int32)
 	if result.Value != nil {
 		for _, size := range *result.Value {
 			instanceType := newInstanceType(size)
 			instanceTypes[instanceType.Name] = instanceType
+			if size.MaxDataDiskCount != nil {
+				maxDataDiskCounts[instanceType.Name] = *size.MaxDataDiskCount
+			}
 			// Create aliases for standard role sizes.
 			if strings.HasPrefix(instanceType.Name, "Standard_") {
 				instanceTypes[instanceType.Name[len("Standard_"):]] = instanceType
@@ -1649,9 +1654,28 @@ func (env *azureEnviron) getInstanceTypesLocked() (map[string]instances.Instance
 		}
 	}
 	env.instanceTypes = instanceTypes
+	env.maxDataDiskCounts = maxDataDiskCounts
 	return instanceTypes, nil
 }
 
+// getMaxDataDiskCount returns the maximum number of data disks that may
+// be attached to a virtual machine of the given size, as reported when
+// listing the VM sizes available for the configured location. If the
+// size is unknown, or its limit was not reported, an error satisfying
+// errors.IsNotFound is returned.
+func (env *azureEnviron) getMaxDataDiskCount(vmSize string) (int32, error) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	if _, err := env.getInstanceTypesLocked(); err != nil {
+		return -1, errors.Annotate(err, "getting instance types")
+	}
+	count, ok := env.maxDataDiskCounts[vmSize]
+	if !ok {
+		return -1, errors.NotFoundf("data disk limit for VM size %q", vmSize)
+	}
+	return count, nil
+}
+
 // getStorageClient queries the storage account key, and uses it to construct
 // a new storage client.
 func (env *azureEnviron) getStorageClient() (internalazurestorage.Client, error) {
@@ -1743,5 +1767,9 @@ func (env *azureEnviron) AgentMirror() (simplestreams.CloudSpec, error) {
 }
 
 func (env *azureEnviron) callAPI(f func() (autorest.Response, error)) error {
-	return backoffAPIRequestCaller{env.provider.config.RetryClock}.call(f)
+	return backoffAPIRequestCaller{
+		clock:    env.provider.config.RetryClock,
+		attempts: env.provider.config.MaxRetryAttempts,
+		jitter:   env.provider.config.RetryJitter,
+	}.call(f)
 }
@@ -4,6 +4,8 @@
 package azure
 
 import (
+	"time"
+
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/juju/errors"
 	"github.com/juju/jsonschema"
@@ -37,6 +39,17 @@ type ProviderConfig struct {
 	// RetryClock is used when retrying API calls due to rate-limiting.
 	RetryClock clock.Clock
 
+	// MaxRetryAttempts is the maximum number of attempts made for
+	// an API call that is being rate-limited. If it is zero, calls
+	// are retried until the maximum retry duration has elapsed.
+	MaxRetryAttempts int
+
+	// RetryJitter, if non-nil, is called with the delay before
+	// retrying a rate-limited API call, and returns a random
+	// duration to add to it. This prevents many clients that
+	// were throttled together from retrying in lockstep.
+	RetryJitter func(time.Duration) time.Duration
+
 	// RandomWindowsAdminPassword is a function used to generate
 	// a random password for the Windows admin user.
 	RandomWindowsAdminPassword func() string
@@ -59,6 +72,9 @@ func (cfg ProviderConfig) Validate() error {
 	if cfg.RetryClock == nil {
 		return errors.NotValidf("nil RetryClock")
 	}
+	if cfg.MaxRetryAttempts < 0 {
+		return errors.NotValidf("negative MaxRetryAttempts")
+	}
 	if cfg.RandomWindowsAdminPassword == nil {
 		return errors.NotValidf("nil RandomWindowsAdminPassword")
 	}
@@ -15,3 +15,7 @@ func ForceVolumeSourceTokenRefresh(vs storage.VolumeSource) error {
 func ForceTokenRefresh(env environs.Environ) error {
 	return env.(*azureEnviron).authorizer.refresh()
 }
+
+var IsVirtualMachineConflict = isVirtualMachineConflict
+
+var MaxConcurrentVirtualMachineRequests = &maxConcurrentVirtualMachineRequests
@@ -31,6 +31,7 @@ func init() {
 	environProvider, err := NewProvider(ProviderConfig{
 		NewStorageClient:                  azurestorage.NewClient,
 		RetryClock:                        &clock.WallClock,
+		RetryJitter:                       randomRetryJitter,
 		RandomWindowsAdminPassword:        randomAdminPassword,
 		GenerateSSHKey:                    ssh.GenerateKey,
 		InteractiveCreateServicePrincipal: azureauth.InteractiveCreateServicePrincipal,
@@ -34,6 +34,22 @@ type BlobStorageClient interface {
 	//
 	// See https://godoc.org/github.com/Azure/azure-sdk-for-go/storage#BlobStorageClient.DeleteBlobIfExists
 	DeleteBlobIfExists(container, name string, extraHeaders map[string]string) (bool, error)
+
+	// GetBlobProperties provides various information about the
+	// specified blob.
+	//
+	// See https://godoc.org/github.com/Azure/azure-sdk-for-go/storage#BlobStorageClient.GetBlobProperties
+	GetBlobProperties(container, name string) (*storage.BlobProperties, error)
+
+	// GetBlobMetadata returns the metadata for the specified blob.
+	//
+	// See https://godoc.org/github.com/Azure/azure-sdk-for-go/storage#BlobStorageClient.GetBlobMetadata
+	GetBlobMetadata(container, name string) (map[string]string, error)
+
+	// SetBlobMetadata replaces the metadata for the specified blob.
+	//
+	// See https://godoc.org/github.com/Azure/azure-sdk-for-go/storage#BlobStorageClient.SetBlobMetadata
+	SetBlobMetadata(container, name string, metadata, extraHeaders map[string]string) error
 }
 
 // NewClientFunc is the type of the NewClient function.
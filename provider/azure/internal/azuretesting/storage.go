@@ -15,6 +15,9 @@ type MockStorageClient struct {
 
 	ListBlobsFunc          func(container string, _ storage.ListBlobsParameters) (storage.BlobListResponse, error)
 	DeleteBlobIfExistsFunc func(container, name string) (bool, error)
+	GetBlobPropertiesFunc  func(container, name string) (*storage.BlobProperties, error)
+	GetBlobMetadataFunc    func(container, name string) (map[string]string, error)
+	SetBlobMetadataFunc    func(container, name string, metadata map[string]string) error
 }
 
 // NewClient exists to satisfy users who want a NewClientFunc.
@@ -48,3 +51,27 @@ func (c *MockStorageClient) DeleteBlobIfExists(container, name string, headers m
 	}
 	return false, c.NextErr()
 }
+
+func (c *MockStorageClient) GetBlobProperties(container, name string) (*storage.BlobProperties, error) {
+	c.MethodCall(c, "GetBlobProperties", container, name)
+	if c.GetBlobPropertiesFunc != nil {
+		return c.GetBlobPropertiesFunc(container, name)
+	}
+	return &storage.BlobProperties{}, c.NextErr()
+}
+
+func (c *MockStorageClient) GetBlobMetadata(container, name string) (map[string]string, error) {
+	c.MethodCall(c, "GetBlobMetadata", container, name)
+	if c.GetBlobMetadataFunc != nil {
+		return c.GetBlobMetadataFunc(container, name)
+	}
+	return nil, c.NextErr()
+}
+
+func (c *MockStorageClient) SetBlobMetadata(container, name string, metadata, headers map[string]string) error {
+	c.MethodCall(c, "SetBlobMetadata", container, name, metadata)
+	if c.SetBlobMetadataFunc != nil {
+		return c.SetBlobMetadataFunc(container, name, metadata)
+	}
+	return c.NextErr()
+}
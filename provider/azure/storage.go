@@ -4,9 +4,12 @@
 package azure
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/arm/compute"
 	armstorage "github.com/Azure/azure-sdk-for-go/arm/storage"
@@ -17,6 +20,7 @@ import (
 	"github.com/juju/schema"
 	"gopkg.in/juju/names.v2"
 
+	"github.com/juju/juju/environs/tags"
 	"github.com/juju/juju/instance"
 	"github.com/juju/juju/provider/azure/internal/armtemplates"
 	internalazurestorage "github.com/juju/juju/provider/azure/internal/azurestorage"
@@ -41,8 +45,16 @@ const (
 
 	// vhdExtension is the filename extension we give to VHDs we create.
 	vhdExtension = ".vhd"
+
+	// maxConcurrentBlobRequests is the maximum number of blob requests
+	// that will be in flight at once when operating on many volumes.
+	maxConcurrentBlobRequests = 10
 )
 
+// maxConcurrentVirtualMachineRequests is the maximum number of requests
+// to get virtual machines that will be in flight at once.
+var maxConcurrentVirtualMachineRequests = 10
+
 // StorageProviderTypes implements storage.ProviderRegistry.
 func (env *azureEnviron) StorageProviderTypes() ([]storage.ProviderType, error) {
 	return []storage.ProviderType{azureStorageProviderType}, nil
@@ -63,22 +75,81 @@ type azureStorageProvider struct {
 
 var _ storage.Provider = (*azureStorageProvider)(nil)
 
-var azureStorageConfigFields = schema.Fields{}
+const (
+	// lunAttribute is the name of the storage pool attribute that
+	// identifies the LUN that volumes should be attached with, both
+	// when they are created and when they are attached later. LUNs
+	// should be assigned contiguously from 0, or the disks may not
+	// be visible to the guest.
+	//
+	// The attribute applies to every volume in the pool, so at most
+	// one volume from such a pool can be attached to each machine;
+	// further attachments fail with an error satisfying
+	// errors.IsAlreadyExists. To pin several disks on one machine,
+	// use a separate pool for each LUN.
+	lunAttribute = "lun"
+
+	// destroyOnDetachAttribute is the name of the storage pool
+	// attribute that controls whether volumes' VHDs are destroyed
+	// once the volumes have been detached.
+	destroyOnDetachAttribute = "destroy-on-detach"
+
+	// maxLUN is the highest LUN that may be assigned to a data disk.
+	// The largest VM sizes support 64 data disks; smaller sizes are
+	// further limited by their maximum data disk count.
+	maxLUN = 63
+
+	// defaultMaxDataDisks is the number of data disks assumed to be
+	// attachable to a virtual machine whose size's limit is unknown.
+	defaultMaxDataDisks = 32
+)
+
+// errAllLUNsInUse is returned when a data disk cannot be attached to a
+// virtual machine because it already has as many as its size allows.
+var errAllLUNsInUse = errors.New("all LUNs are in use")
+
+var azureStorageConfigFields = schema.Fields{
+	lunAttribute:             schema.ForceInt(),
+	destroyOnDetachAttribute: schema.Bool(),
+}
 
 var azureStorageConfigChecker = schema.FieldMap(
 	azureStorageConfigFields,
-	schema.Defaults{},
+	schema.Defaults{
+		lunAttribute:             schema.Omit,
+		destroyOnDetachAttribute: false,
+	},
 )
 
 type azureStorageConfig struct {
+	// lun, if non-nil, is the LUN that a volume should be attached
+	// with, in place of the lowest free LUN.
+	lun *int32
+
+	// destroyOnDetach reports whether a volume's VHD should be
+	// destroyed once the volume has been detached.
+	destroyOnDetach bool
 }
 
 func newAzureStorageConfig(attrs map[string]interface{}) (*azureStorageConfig, error) {
-	_, err := azureStorageConfigChecker.Coerce(attrs, nil)
+	coerced, err := azureStorageConfigChecker.Coerce(attrs, nil)
 	if err != nil {
 		return nil, errors.Annotate(err, "validating Azure storage config")
 	}
-	azureStorageConfig := &azureStorageConfig{}
+	values := coerced.(map[string]interface{})
+	azureStorageConfig := &azureStorageConfig{
+		destroyOnDetach: values[destroyOnDetachAttribute].(bool),
+	}
+	if lun, ok := values[lunAttribute]; ok {
+		lun := int32(lun.(int))
+		if lun < 0 || lun > maxLUN {
+			return nil, errors.NotValidf(
+				"%s %d (must be between 0 and %d)",
+				lunAttribute, lun, maxLUN,
+			)
+		}
+		azureStorageConfig.lun = &lun
+	}
 	return azureStorageConfig, nil
 }
 
@@ -110,10 +181,15 @@ func (e *azureStorageProvider) DefaultPools() []*storage.Config {
 
 // VolumeSource is part of the Provider interface.
 func (e *azureStorageProvider) VolumeSource(cfg *storage.Config) (storage.VolumeSource, error) {
-	if err := e.ValidateConfig(cfg); err != nil {
+	storageConfig, err := newAzureStorageConfig(cfg.Attrs())
+	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return &azureVolumeSource{e.env}, nil
+	return &azureVolumeSource{
+		env:             e.env,
+		lun:             storageConfig.lun,
+		destroyOnDetach: storageConfig.destroyOnDetach,
+	}, nil
 }
 
 // FilesystemSource is part of the Provider interface.
@@ -121,19 +197,49 @@ func (e *azureStorageProvider) FilesystemSource(providerConfig *storage.Config)
 	return nil, errors.NotSupportedf("filesystems")
 }
 
+var _ storage.ObservingVolumeCreator = (*azureVolumeSource)(nil)
+
 type azureVolumeSource struct {
 	env *azureEnviron
+
+	// lun, if non-nil, is the LUN that AttachVolumes should
+	// attach volumes with, in place of the lowest free LUN.
+	lun *int32
+
+	// destroyOnDetach reports whether DetachVolumes should
+	// destroy the VHDs of successfully detached volumes.
+	destroyOnDetach bool
 }
 
 // CreateVolumes is specified on the storage.VolumeSource interface.
-func (v *azureVolumeSource) CreateVolumes(params []storage.VolumeParams) (_ []storage.CreateVolumesResult, err error) {
+func (v *azureVolumeSource) CreateVolumes(params []storage.VolumeParams) ([]storage.CreateVolumesResult, error) {
+	return v.CreateVolumesWithObserver(params, nil)
+}
+
+// CreateVolumesWithObserver is specified on the
+// storage.ObservingVolumeCreator interface.
+//
+// Volumes that fail validation, or that cannot be added to their virtual
+// machines, are observed straight away; the others are observed as each
+// of their virtual machines is updated.
+func (v *azureVolumeSource) CreateVolumesWithObserver(
+	params []storage.VolumeParams, observe storage.CreateVolumesObserver,
+) (_ []storage.CreateVolumesResult, err error) {
 
 	// First, validate the params before we use them.
 	results := make([]storage.CreateVolumesResult, len(params))
+	observed := make([]bool, len(params))
+	notify := func(i int, result storage.CreateVolumesResult) {
+		if observe != nil && !observed[i] {
+			observed[i] = true
+			observe(i, result)
+		}
+	}
 	var instanceIds []instance.Id
 	for i, p := range params {
 		if err := v.ValidateVolumeParams(p); err != nil {
 			results[i].Error = err
+			notify(i, results[i])
 			continue
 		}
 		instanceIds = append(instanceIds, p.Attachment.InstanceId)
@@ -141,10 +247,7 @@ func (v *azureVolumeSource) CreateVolumes(params []storage.VolumeParams) (_ []st
 	if len(instanceIds) == 0 {
 		return results, nil
 	}
-	virtualMachines, err := v.virtualMachines(instanceIds)
-	if err != nil {
-		return nil, errors.Annotate(err, "getting virtual machines")
-	}
+	virtualMachines := v.virtualMachines(instanceIds)
 	storageAccount, err := v.env.getStorageAccount(false)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -152,6 +255,11 @@ func (v *azureVolumeSource) CreateVolumes(params []storage.VolumeParams) (_ []st
 
 	// Update VirtualMachine objects in-memory,
 	// and then perform the updates all at once.
+	//
+	// A virtual machine does not require an update
+	// if no volumes could be created for it, so we
+	// keep a record of which VMs need updating.
+	changed := make(map[instance.Id]bool, len(virtualMachines))
 	for i, p := range params {
 		if results[i].Error != nil {
 			continue
@@ -162,21 +270,42 @@ func (v *azureVolumeSource) CreateVolumes(params []storage.VolumeParams) (_ []st
 		}
 		if vm.err != nil {
 			results[i].Error = vm.err
+			notify(i, results[i])
 			continue
 		}
 		volume, volumeAttachment, err := v.createVolume(
 			vm.vm, p, storageAccount,
 		)
 		if err != nil {
+			// createVolume leaves the virtual machine unmodified
+			// on error, so other volumes may still be created and
+			// attached to it.
 			results[i].Error = err
-			vm.err = err
+			notify(i, results[i])
 			continue
 		}
 		results[i].Volume = volume
 		results[i].VolumeAttachment = volumeAttachment
+		changed[p.Attachment.InstanceId] = true
+	}
+	for _, instanceId := range instanceIds {
+		if !changed[instanceId] {
+			delete(virtualMachines, instanceId)
+		}
 	}
 
-	updateResults, err := v.updateVirtualMachines(virtualMachines, instanceIds)
+	updateResults, err := v.updateVirtualMachines(virtualMachines, instanceIds, func(instanceId instance.Id, err error) {
+		for i, p := range params {
+			if results[i].Error != nil || p.Attachment.InstanceId != instanceId {
+				continue
+			}
+			result := results[i]
+			if err != nil {
+				result = storage.CreateVolumesResult{Error: err}
+			}
+			notify(i, result)
+		}
+	})
 	if err != nil {
 		return nil, errors.Annotate(err, "updating virtual machines")
 	}
@@ -188,6 +317,9 @@ func (v *azureVolumeSource) CreateVolumes(params []storage.VolumeParams) (_ []st
 		results[i].Volume = nil
 		results[i].VolumeAttachment = nil
 	}
+	for i, result := range results {
+		notify(i, result)
+	}
 	return results, nil
 }
 
@@ -200,7 +332,11 @@ func (v *azureVolumeSource) createVolume(
 	storageAccount *armstorage.Account,
 ) (*storage.Volume, *storage.VolumeAttachment, error) {
 
-	lun, err := nextAvailableLUN(vm)
+	cfg, err := newAzureStorageConfig(p.Attributes)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	lun, err := chooseLUN(vm, cfg.lun, v.maxDataDisks(vm))
 	if err != nil {
 		return nil, nil, errors.Annotate(err, "choosing LUN")
 	}
@@ -250,6 +386,10 @@ func (v *azureVolumeSource) createVolume(
 }
 
 // ListVolumes is specified on the storage.VolumeSource interface.
+//
+// Only volumes created by Juju are listed. Imported volumes may be backed
+// by blobs in any container of the model's storage account, and are
+// removed along with it when the model is destroyed.
 func (v *azureVolumeSource) ListVolumes() ([]string, error) {
 	blobs, err := v.listBlobs()
 	if err != nil {
@@ -293,36 +433,66 @@ func (v *azureVolumeSource) listBlobs() ([]azurestorage.Blob, error) {
 
 // DescribeVolumes is specified on the storage.VolumeSource interface.
 func (v *azureVolumeSource) DescribeVolumes(volumeIds []string) ([]storage.DescribeVolumesResult, error) {
-	blobs, err := v.listBlobs()
+	client, err := v.env.getStorageClient()
 	if err != nil {
-		return nil, errors.Annotate(err, "listing volumes")
-	}
-
-	byVolumeId := make(map[string]azurestorage.Blob)
-	for _, blob := range blobs {
-		volumeId, ok := blobVolumeId(blob)
-		if !ok {
-			continue
-		}
-		byVolumeId[volumeId] = blob
+		return nil, errors.Trace(err)
 	}
+	blobsClient := client.GetBlobService()
 
+	// The volumes' blob properties are fetched concurrently, with
+	// at most maxConcurrentBlobRequests requests in flight.
 	results := make([]storage.DescribeVolumesResult, len(volumeIds))
+	sem := make(chan struct{}, maxConcurrentBlobRequests)
+	var wg sync.WaitGroup
 	for i, volumeId := range volumeIds {
-		blob, ok := byVolumeId[volumeId]
-		if !ok {
-			results[i].Error = errors.NotFoundf("%s", volumeId)
-			continue
-		}
-		sizeInMib := blob.Properties.ContentLength / (1024 * 1024)
-		results[i].VolumeInfo = &storage.VolumeInfo{
-			VolumeId:   volumeId,
-			Size:       uint64(sizeInMib),
-			Persistent: true,
+		wg.Add(1)
+		go func(i int, volumeId string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			volumeInfo, err := describeVolume(blobsClient, volumeId)
+			if err != nil {
+				results[i].Error = err
+				return
+			}
+			results[i].VolumeInfo = volumeInfo
+		}(i, volumeId)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// describeVolume returns information about the volume with the given
+// ID, from the properties of its VHD blob.
+func describeVolume(
+	blobsClient internalazurestorage.BlobStorageClient,
+	volumeId string,
+) (*storage.VolumeInfo, error) {
+	container, blobName, err := volumeBlob(volumeId)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	properties, err := blobsClient.GetBlobProperties(container, blobName)
+	if err != nil {
+		if err, ok := err.(azurestorage.AzureStorageServiceError); ok && err.StatusCode == http.StatusNotFound {
+			return nil, errors.NotFoundf("%s", volumeId)
 		}
+		return nil, errors.Annotatef(err, "getting properties of volume %q", volumeId)
 	}
+	sizeInMib := properties.ContentLength / (1024 * 1024)
+	return &storage.VolumeInfo{
+		VolumeId:   volumeId,
+		Size:       uint64(sizeInMib),
+		Persistent: blobVolumePersistent(properties.BlobType),
+	}, nil
+}
 
-	return results, nil
+// blobVolumePersistent reports whether a volume backed by a blob of the
+// given type outlives the machine it is attached to. Disks backed by VHD
+// page blobs are persistent; a blob of any other type cannot back a disk,
+// and so is not reported as persistent storage.
+func blobVolumePersistent(blobType azurestorage.BlobType) bool {
+	return blobType == azurestorage.BlobTypePage
 }
 
 // DestroyVolumes is specified on the storage.VolumeSource interface.
@@ -334,16 +504,98 @@ func (v *azureVolumeSource) DestroyVolumes(volumeIds []string) ([]error, error)
 	blobsClient := client.GetBlobService()
 	results := make([]error, len(volumeIds))
 	for i, volumeId := range volumeIds {
-		_, err := blobsClient.DeleteBlobIfExists(
-			dataDiskVHDContainer, volumeId+vhdExtension, nil,
-		)
+		container, blobName, err := volumeBlob(volumeId)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		_, err = blobsClient.DeleteBlobIfExists(container, blobName, nil)
 		results[i] = err
 	}
 	return results, nil
 }
 
+// ImportVolume is specified on the storage.VolumeImporter interface.
+//
+// The volume is identified by the URI of its VHD blob, which may be any
+// page blob in the model's storage account. The imported volume's ID is
+// "<container>/<blob>", which cannot clash with the IDs of volumes created
+// by Juju. Blobs are neither renamed nor copied, so blobs in the OS disk
+// container, and blobs whose names are reserved for volumes created by
+// Juju, are rejected. A blob that is already tagged with a model UUID is
+// managed by Juju, and will not be imported. The blob's data is left
+// untouched; the given resource tags, along with the model's UUID, are
+// merged into its existing metadata.
+func (v *azureVolumeSource) ImportVolume(blobURI string, resourceTags map[string]string) (storage.VolumeInfo, error) {
+	storageAccount, err := v.env.getStorageAccount(false)
+	if err != nil {
+		return storage.VolumeInfo{}, errors.Trace(err)
+	}
+	volumeId, err := blobURIVolumeId(storageAccount, blobURI)
+	if err != nil {
+		return storage.VolumeInfo{}, errors.Trace(err)
+	}
+
+	client, err := v.env.getStorageClient()
+	if err != nil {
+		return storage.VolumeInfo{}, errors.Trace(err)
+	}
+	blobsClient := client.GetBlobService()
+	container, blobName, err := volumeBlob(volumeId)
+	if err != nil {
+		return storage.VolumeInfo{}, errors.Trace(err)
+	}
+	properties, err := blobsClient.GetBlobProperties(container, blobName)
+	if err != nil {
+		if err, ok := err.(azurestorage.AzureStorageServiceError); ok && err.StatusCode == http.StatusNotFound {
+			return storage.VolumeInfo{}, errors.NotFoundf("blob %q", blobURI)
+		}
+		return storage.VolumeInfo{}, errors.Annotate(err, "getting blob properties")
+	}
+	if properties.BlobType != azurestorage.BlobTypePage {
+		return storage.VolumeInfo{}, errors.NotValidf(
+			"blob %q with type %q (VHDs must be page blobs)",
+			blobURI, properties.BlobType,
+		)
+	}
+
+	metadata, err := blobsClient.GetBlobMetadata(container, blobName)
+	if err != nil {
+		return storage.VolumeInfo{}, errors.Annotate(err, "getting blob metadata")
+	}
+	if owner, ok := metadata[blobMetadataKey(tags.JujuModel)]; ok {
+		return storage.VolumeInfo{}, errors.NotValidf(
+			"blob %q (already managed by model %q)", blobURI, owner,
+		)
+	}
+
+	v.env.mu.Lock()
+	modelUUID := v.env.config.Config.UUID()
+	v.env.mu.Unlock()
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	for k, value := range resourceTags {
+		metadata[blobMetadataKey(k)] = value
+	}
+	metadata[blobMetadataKey(tags.JujuModel)] = modelUUID
+	if err := blobsClient.SetBlobMetadata(container, blobName, metadata, nil); err != nil {
+		return storage.VolumeInfo{}, errors.Annotate(err, "tagging blob")
+	}
+
+	sizeInMib := properties.ContentLength / (1024 * 1024)
+	return storage.VolumeInfo{
+		VolumeId:   volumeId,
+		Size:       uint64(sizeInMib),
+		Persistent: blobVolumePersistent(properties.BlobType),
+	}, nil
+}
+
 // ValidateVolumeParams is specified on the storage.VolumeSource interface.
 func (v *azureVolumeSource) ValidateVolumeParams(params storage.VolumeParams) error {
+	if _, err := newAzureStorageConfig(params.Attributes); err != nil {
+		return errors.Trace(err)
+	}
 	if mibToGib(params.Size) > volumeSizeMaxGiB {
 		return errors.Errorf(
 			"%d GiB exceeds the maximum of %d GiB",
@@ -364,10 +616,7 @@ func (v *azureVolumeSource) AttachVolumes(attachParams []storage.VolumeAttachmen
 	if len(instanceIds) == 0 {
 		return results, nil
 	}
-	virtualMachines, err := v.virtualMachines(instanceIds)
-	if err != nil {
-		return nil, errors.Annotate(err, "getting virtual machines")
-	}
+	virtualMachines := v.virtualMachines(instanceIds)
 	storageAccount, err := v.env.getStorageAccount(false)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -389,12 +638,18 @@ func (v *azureVolumeSource) AttachVolumes(attachParams []storage.VolumeAttachmen
 			results[i].Error = vm.err
 			continue
 		}
+		if err := checkDataDisk(vm.vm, p); err != nil {
+			results[i].Error = err
+			continue
+		}
 		volumeAttachment, updated, err := v.attachVolume(
 			vm.vm, p, storageAccount,
 		)
 		if err != nil {
+			// attachVolume leaves the virtual machine unmodified
+			// on error, so other volumes may still be attached
+			// to it.
 			results[i].Error = err
-			vm.err = err
 			continue
 		}
 		results[i].VolumeAttachment = volumeAttachment
@@ -408,7 +663,7 @@ func (v *azureVolumeSource) AttachVolumes(attachParams []storage.VolumeAttachmen
 		}
 	}
 
-	updateResults, err := v.updateVirtualMachines(virtualMachines, instanceIds)
+	updateResults, err := v.updateVirtualMachines(virtualMachines, instanceIds, nil)
 	if err != nil {
 		return nil, errors.Annotate(err, "updating virtual machines")
 	}
@@ -433,19 +688,25 @@ func (v *azureVolumeSource) attachVolume(
 		return nil, false, errors.Trace(err)
 	}
 
-	dataDisksRoot := dataDiskVhdRoot(storageAccount)
-	dataDiskName := p.VolumeId
-	vhdURI := dataDisksRoot + dataDiskName + vhdExtension
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil {
+		// A virtual machine with no storage profile
+		// cannot have data disks attached to it.
+		return nil, false, errors.NotValidf("instance %v with no storage profile", p.InstanceId)
+	}
+	dataDiskName, vhdURI, err := dataDiskVhd(storageAccount, p.VolumeId)
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
 
 	var dataDisks []compute.DataDisk
 	if vm.Properties.StorageProfile.DataDisks != nil {
 		dataDisks = *vm.Properties.StorageProfile.DataDisks
 	}
 	for _, disk := range dataDisks {
-		if to.String(disk.Name) != p.VolumeId {
+		if to.String(disk.Name) != dataDiskName {
 			continue
 		}
-		if to.String(disk.Vhd.URI) != vhdURI {
+		if disk.Vhd == nil || to.String(disk.Vhd.URI) != vhdURI {
 			continue
 		}
 		// Disk is already attached.
@@ -459,7 +720,7 @@ func (v *azureVolumeSource) attachVolume(
 		return volumeAttachment, false, nil
 	}
 
-	lun, err := nextAvailableLUN(vm)
+	lun, err := chooseLUN(vm, v.lun, v.maxDataDisks(vm))
 	if err != nil {
 		return nil, false, errors.Annotate(err, "choosing LUN")
 	}
@@ -494,10 +755,7 @@ func (v *azureVolumeSource) DetachVolumes(attachParams []storage.VolumeAttachmen
 	if len(instanceIds) == 0 {
 		return results, nil
 	}
-	virtualMachines, err := v.virtualMachines(instanceIds)
-	if err != nil {
-		return nil, errors.Annotate(err, "getting virtual machines")
-	}
+	virtualMachines := v.virtualMachines(instanceIds)
 	storageAccount, err := v.env.getStorageAccount(false)
 	if err != nil {
 		return nil, errors.Annotate(err, "getting storage account")
@@ -509,7 +767,12 @@ func (v *azureVolumeSource) DetachVolumes(attachParams []storage.VolumeAttachmen
 	// An detachment does not require an update
 	// if the disk isn't attached, so we keep a
 	// record of which VMs need updating.
+	//
+	// We also record which volumes were detached, so
+	// that only those are confirmed and, if required,
+	// destroyed.
 	changed := make(map[instance.Id]bool, len(virtualMachines))
+	detached := make([]bool, len(attachParams))
 	for i, p := range attachParams {
 		vm, ok := virtualMachines[p.InstanceId]
 		if !ok {
@@ -519,8 +782,13 @@ func (v *azureVolumeSource) DetachVolumes(attachParams []storage.VolumeAttachmen
 			results[i] = vm.err
 			continue
 		}
+		if err := checkDataDisk(vm.vm, p); err != nil {
+			results[i] = err
+			continue
+		}
 		if v.detachVolume(vm.vm, p, storageAccount) {
 			changed[p.InstanceId] = true
+			detached[i] = true
 		}
 	}
 	for _, instanceId := range instanceIds {
@@ -529,7 +797,7 @@ func (v *azureVolumeSource) DetachVolumes(attachParams []storage.VolumeAttachmen
 		}
 	}
 
-	updateResults, err := v.updateVirtualMachines(virtualMachines, instanceIds)
+	updateResults, err := v.updateVirtualMachines(virtualMachines, instanceIds, nil)
 	if err != nil {
 		return nil, errors.Annotate(err, "updating virtual machines")
 	}
@@ -539,28 +807,141 @@ func (v *azureVolumeSource) DetachVolumes(attachParams []storage.VolumeAttachmen
 		}
 		results[i] = err
 	}
+
+	// Confirm that the updated virtual machines no longer
+	// have the disks attached before reporting success.
+	updated := make(map[instance.Id]*maybeVirtualMachine)
+	for i, p := range attachParams {
+		if results[i] != nil || !detached[i] {
+			continue
+		}
+		vm, ok := updated[p.InstanceId]
+		if !ok {
+			vm = v.virtualMachine(p.InstanceId)
+			updated[p.InstanceId] = vm
+		}
+		if vm.err != nil {
+			results[i] = vm.err
+			continue
+		}
+		var state string
+		if vm.vm.Properties != nil {
+			state = to.String(vm.vm.Properties.ProvisioningState)
+		}
+		if state != "Succeeded" {
+			results[i] = errors.Errorf(
+				"updating instance %v: provisioning state is %q",
+				p.InstanceId, state,
+			)
+			continue
+		}
+		// detachVolume only reports an update if
+		// the disk is still attached.
+		if v.detachVolume(vm.vm, p, storageAccount) {
+			results[i] = errors.Errorf(
+				"volume %q is still attached to instance %v",
+				p.VolumeId, p.InstanceId,
+			)
+		}
+	}
+
+	if v.destroyOnDetach {
+		if err := v.destroyDetachedVolumes(attachParams, detached, results); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
 	return results, nil
 }
 
+// virtualMachine returns the VirtualMachine with the specified
+// instance ID, or an error.
+func (v *azureVolumeSource) virtualMachine(instanceId instance.Id) *maybeVirtualMachine {
+	vm, etag, err := v.getVirtualMachine(instanceId)
+	if err != nil {
+		return &maybeVirtualMachine{err: errors.Annotate(err, "getting virtual machine")}
+	}
+	return newMaybeVirtualMachine(vm, etag)
+}
+
+// getVirtualMachine gets the VirtualMachine with the specified instance
+// ID, returning it along with the entity tag reported for it, if any.
+func (v *azureVolumeSource) getVirtualMachine(instanceId instance.Id) (*compute.VirtualMachine, string, error) {
+	vmsClient := compute.VirtualMachinesClient{v.env.compute}
+	var vm compute.VirtualMachine
+	if err := v.env.callAPI(func() (autorest.Response, error) {
+		var err error
+		vm, err = vmsClient.Get(v.env.resourceGroup, string(instanceId), "")
+		return vm.Response, err
+	}); err != nil {
+		if vm.Response.Response != nil && vm.StatusCode == http.StatusNotFound {
+			return nil, "", errors.NotFoundf("instance %v", instanceId)
+		}
+		return nil, "", errors.Trace(err)
+	}
+	var etag string
+	if vm.Response.Response != nil {
+		etag = vm.Header.Get("ETag")
+	}
+	return &vm, etag, nil
+}
+
+// destroyDetachedVolumes destroys the VHDs of the volumes in attachParams
+// that were detached, and whose detachment was confirmed (that is, whose
+// corresponding results are nil), recording any failures in results.
+// Volumes that were not attached in the first place are left alone.
+func (v *azureVolumeSource) destroyDetachedVolumes(
+	attachParams []storage.VolumeAttachmentParams, detached []bool, results []error,
+) error {
+	var volumeIds []string
+	var indices []int
+	for i, p := range attachParams {
+		if detached[i] && results[i] == nil {
+			volumeIds = append(volumeIds, p.VolumeId)
+			indices = append(indices, i)
+		}
+	}
+	if len(volumeIds) == 0 {
+		return nil
+	}
+	destroyResults, err := v.DestroyVolumes(volumeIds)
+	if err != nil {
+		return errors.Annotate(err, "destroying detached volumes")
+	}
+	for j, err := range destroyResults {
+		if err != nil {
+			results[indices[j]] = errors.Annotate(err, "destroying detached volume")
+		}
+	}
+	return nil
+}
+
 func (v *azureVolumeSource) detachVolume(
 	vm *compute.VirtualMachine,
 	p storage.VolumeAttachmentParams,
 	storageAccount *armstorage.Account,
 ) (updated bool) {
 
-	dataDisksRoot := dataDiskVhdRoot(storageAccount)
-	dataDiskName := p.VolumeId
-	vhdURI := dataDisksRoot + dataDiskName + vhdExtension
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil {
+		// A virtual machine with no storage profile
+		// has no data disks to detach.
+		return false
+	}
+	dataDiskName, vhdURI, err := dataDiskVhd(storageAccount, p.VolumeId)
+	if err != nil {
+		// The volume ID has been validated by checkDataDisk,
+		// so it cannot identify an attached data disk.
+		return false
+	}
 
 	var dataDisks []compute.DataDisk
 	if vm.Properties.StorageProfile.DataDisks != nil {
 		dataDisks = *vm.Properties.StorageProfile.DataDisks
 	}
 	for i, disk := range dataDisks {
-		if to.String(disk.Name) != p.VolumeId {
+		if to.String(disk.Name) != dataDiskName {
 			continue
 		}
-		if to.String(disk.Vhd.URI) != vhdURI {
+		if disk.Vhd == nil || to.String(disk.Vhd.URI) != vhdURI {
 			continue
 		}
 		dataDisks = append(dataDisks[:i], dataDisks[i+1:]...)
@@ -574,50 +955,202 @@ func (v *azureVolumeSource) detachVolume(
 	return false
 }
 
+// checkDataDisk returns an error if the volume in the given attachment
+// parameters does not identify a data disk of the virtual machine. The
+// volume source only ever manipulates data disks; this guards against
+// detaching a virtual machine's OS disk, or any other disk that was not
+// attached by Juju.
+func checkDataDisk(vm *compute.VirtualMachine, p storage.VolumeAttachmentParams) error {
+	if _, _, err := volumeBlob(p.VolumeId); err != nil {
+		return errors.Trace(err)
+	}
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil {
+		return nil
+	}
+	storageProfile := vm.Properties.StorageProfile
+	diskName := dataDiskName(p.VolumeId)
+	if osDisk := storageProfile.OsDisk; osDisk != nil && to.String(osDisk.Name) == diskName {
+		return errors.Errorf(
+			"volume %q is the OS disk of instance %v, refusing to modify it",
+			p.VolumeId, p.InstanceId,
+		)
+	}
+	if storageProfile.DataDisks == nil {
+		return nil
+	}
+	for _, disk := range *storageProfile.DataDisks {
+		if to.String(disk.Name) == diskName && disk.Lun == nil {
+			return errors.Errorf(
+				"volume %q attached to instance %v has no LUN, refusing to modify it",
+				p.VolumeId, p.InstanceId,
+			)
+		}
+	}
+	return nil
+}
+
+// validateDataDiskVolumeId returns an error if the given volume ID is
+// not one that the volume source would have assigned to a data disk.
+// OS disks are named after their virtual machines, so this prevents
+// them from being mistaken for volumes.
+func validateDataDiskVolumeId(volumeId string) error {
+	if _, err := names.ParseVolumeTag(volumeId); err != nil {
+		return errors.NotValidf("volume ID %q (expected a data disk name)", volumeId)
+	}
+	return nil
+}
+
+// volumeBlob returns the container and name of the VHD blob backing the
+// volume with the given ID. Volumes created by Juju are named after their
+// volume tags, and are backed by blobs in the data-disk container; the IDs
+// of imported volumes have the form "<container>/<blob>".
+func volumeBlob(volumeId string) (container, blobName string, _ error) {
+	if i := strings.Index(volumeId, "/"); i >= 0 {
+		container, blobName = volumeId[:i], volumeId[i+1:]
+		if err := validateImportedBlob(container, blobName); err != nil {
+			return "", "", errors.Trace(err)
+		}
+		return container, blobName, nil
+	}
+	if err := validateDataDiskVolumeId(volumeId); err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return dataDiskVHDContainer, volumeId + vhdExtension, nil
+}
+
+// validateImportedBlob returns an error if the blob with the given
+// container and name may not back an imported volume. OS disks are not
+// volumes, and blobs named after volume tags in the data-disk container
+// are reserved for volumes created by Juju.
+func validateImportedBlob(container, blobName string) error {
+	if container == "" || blobName == "" {
+		return errors.NotValidf(
+			"blob %q (expected \"<container>/<blob>\")",
+			container+"/"+blobName,
+		)
+	}
+	switch container {
+	case osDiskVHDContainer:
+		return errors.NotValidf(
+			"blob %q (container %q holds OS disks)",
+			container+"/"+blobName, container,
+		)
+	case dataDiskVHDContainer:
+		if _, ok := blobVolumeId(azurestorage.Blob{Name: blobName}); ok {
+			return errors.NotValidf(
+				"blob %q (name is reserved for volumes created by Juju; "+
+					"copy the blob to another name to import it)",
+				container+"/"+blobName,
+			)
+		}
+	}
+	return nil
+}
+
+// dataDiskName returns the name of the data disk that attaches the volume
+// with the given ID. Disks for volumes created by Juju are named after the
+// volume; imported volumes' IDs may be long, or contain characters that
+// are not valid in disk names, so their disks are named after a hash of
+// the volume ID.
+func dataDiskName(volumeId string) string {
+	if !strings.Contains(volumeId, "/") {
+		return volumeId
+	}
+	sum := sha256.Sum256([]byte(volumeId))
+	return fmt.Sprintf("imported-%x", sum[:8])
+}
+
+// dataDiskVhd returns the name of the data disk that attaches the volume
+// with the given ID, and the URI of the VHD blob backing it.
+func dataDiskVhd(storageAccount *armstorage.Account, volumeId string) (name, vhdURI string, _ error) {
+	container, blobName, err := volumeBlob(volumeId)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return dataDiskName(volumeId), blobContainerURL(storageAccount, container) + blobName, nil
+}
+
 type maybeVirtualMachine struct {
 	vm  *compute.VirtualMachine
 	err error
+
+	// etag is the entity tag reported for vm when it was read, or
+	// empty if none was reported. Updates to the virtual machine are
+	// made conditional on the entity tag being unchanged.
+	etag string
+
+	// dataDisks holds the virtual machine's data disks as they were
+	// when it was read, so that changes made to vm in-memory can be
+	// reapplied to a re-read virtual machine after a conflict.
+	dataDisks []compute.DataDisk
 }
 
-// virtualMachines returns a mapping of instance IDs to VirtualMachines and
-// errors, for each of the specified instance IDs.
-func (v *azureVolumeSource) virtualMachines(instanceIds []instance.Id) (map[instance.Id]*maybeVirtualMachine, error) {
-	vmsClient := compute.VirtualMachinesClient{v.env.compute}
-	var result compute.VirtualMachineListResult
-	if err := v.env.callAPI(func() (autorest.Response, error) {
-		var err error
-		result, err = vmsClient.List(v.env.resourceGroup)
-		return result.Response, err
-	}); err != nil {
-		return nil, errors.Annotate(err, "listing virtual machines")
+func newMaybeVirtualMachine(vm *compute.VirtualMachine, etag string) *maybeVirtualMachine {
+	return &maybeVirtualMachine{
+		vm:        vm,
+		etag:      etag,
+		dataDisks: copyDataDisks(vm),
 	}
+}
 
-	all := make(map[instance.Id]*compute.VirtualMachine)
-	if result.Value != nil {
-		for _, vm := range *result.Value {
-			vmCopy := vm
-			all[instance.Id(to.String(vm.Name))] = &vmCopy
+// virtualMachines returns a mapping of instance IDs to VirtualMachines and
+// errors, for each of the specified instance IDs. Each virtual machine is
+// read individually, so that its entity tag is known when updating it. The
+// virtual machines are read concurrently, with at most
+// maxConcurrentVirtualMachineRequests requests in flight.
+func (v *azureVolumeSource) virtualMachines(instanceIds []instance.Id) map[instance.Id]*maybeVirtualMachine {
+	var ids []instance.Id
+	seen := make(map[instance.Id]bool)
+	for _, id := range instanceIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
 		}
 	}
+
+	vms := make([]*maybeVirtualMachine, len(ids))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < maxConcurrentVirtualMachineRequests && n < len(ids); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				vm, etag, err := v.getVirtualMachine(ids[i])
+				if err != nil {
+					if !errors.IsNotFound(err) {
+						err = errors.Annotate(err, "getting virtual machine")
+					}
+					vms[i] = &maybeVirtualMachine{err: err}
+					continue
+				}
+				vms[i] = newMaybeVirtualMachine(vm, etag)
+			}
+		}()
+	}
+	for i := range ids {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
 	results := make(map[instance.Id]*maybeVirtualMachine)
-	for _, id := range instanceIds {
-		result := &maybeVirtualMachine{vm: all[id]}
-		if result.vm == nil {
-			result.err = errors.NotFoundf("instance %v", id)
-		}
-		results[id] = result
+	for i, id := range ids {
+		results[id] = vms[i]
 	}
-	return results, nil
+	return results
 }
 
 // updateVirtualMachines updates virtual machines in the given map by iterating
 // through the list of instance IDs in order, and updating each corresponding
-// virtual machine at most once.
+// virtual machine at most once. If updated is non-nil, it is called with the
+// outcome of each update as soon as it is attempted.
 func (v *azureVolumeSource) updateVirtualMachines(
-	virtualMachines map[instance.Id]*maybeVirtualMachine, instanceIds []instance.Id,
+	virtualMachines map[instance.Id]*maybeVirtualMachine,
+	instanceIds []instance.Id,
+	updated func(instance.Id, error),
 ) ([]error, error) {
 	results := make([]error, len(instanceIds))
-	vmsClient := compute.VirtualMachinesClient{v.env.compute}
 	for i, instanceId := range instanceIds {
 		vm, ok := virtualMachines[instanceId]
 		if !ok {
@@ -627,12 +1160,11 @@ func (v *azureVolumeSource) updateVirtualMachines(
 			results[i] = vm.err
 			continue
 		}
-		if err := v.env.callAPI(func() (autorest.Response, error) {
-			return vmsClient.CreateOrUpdate(
-				v.env.resourceGroup, to.String(vm.vm.Name), *vm.vm,
-				nil, // abort channel
-			)
-		}); err != nil {
+		err := v.updateVirtualMachine(instanceId, vm)
+		if updated != nil {
+			updated(instanceId, err)
+		}
+		if err != nil {
 			results[i] = err
 			vm.err = err
 			continue
@@ -643,26 +1175,267 @@ func (v *azureVolumeSource) updateVirtualMachines(
 	return results, nil
 }
 
-func nextAvailableLUN(vm *compute.VirtualMachine) (int32, error) {
+// maxVirtualMachineUpdateAttempts is the maximum number of times
+// updateVirtualMachine will attempt to update a virtual machine
+// that is being modified concurrently.
+const maxVirtualMachineUpdateAttempts = 3
+
+// updateVirtualMachine updates the given virtual machine, conditional on
+// it not having been modified since it was read. If it has been modified,
+// the virtual machine is re-read, the in-memory changes to its data disks
+// are reapplied, and the update is retried. If the virtual machine is still
+// being modified after maxVirtualMachineUpdateAttempts attempts, an error
+// satisfying isVirtualMachineConflict is returned.
+//
+// If no entity tag was reported when the virtual machine was read, the
+// update cannot be made conditional. Instead, the virtual machine is
+// re-read immediately before updating it, and the in-memory changes are
+// reapplied if its data disks have changed in the meantime.
+func (v *azureVolumeSource) updateVirtualMachine(instanceId instance.Id, vm *maybeVirtualMachine) error {
+	if vm.etag == "" {
+		logger.Debugf("no entity tag for instance %v, checking for concurrent changes", instanceId)
+		if err := v.refreshVirtualMachine(instanceId, vm); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	vmsClient := compute.VirtualMachinesClient{v.env.compute}
+	for attempt := 1; ; attempt++ {
+		var resp autorest.Response
+		err := v.env.callAPI(func() (autorest.Response, error) {
+			var err error
+			resp, err = createOrUpdateVirtualMachineIfMatch(
+				vmsClient, v.env.resourceGroup, *vm.vm, vm.etag,
+			)
+			return resp, err
+		})
+		if err == nil {
+			return nil
+		}
+		if resp.Response == nil || resp.StatusCode != http.StatusPreconditionFailed {
+			return err
+		}
+		if attempt == maxVirtualMachineUpdateAttempts {
+			return &virtualMachineConflictError{instanceId}
+		}
+		logger.Debugf("instance %v was modified concurrently, retrying update", instanceId)
+
+		latest, etag, err := v.getVirtualMachine(instanceId)
+		if err != nil {
+			return errors.Annotate(err, "getting virtual machine")
+		}
+		dataDisks := copyDataDisks(latest)
+		if err := rebaseDataDisks(latest, vm.dataDisks, vm.vm); err != nil {
+			return errors.Annotatef(err, "updating instance %v", instanceId)
+		}
+		vm.vm, vm.etag, vm.dataDisks = latest, etag, dataDisks
+	}
+}
+
+// refreshVirtualMachine re-reads the given virtual machine, which has no
+// entity tag. If its data disks have changed since it was read, the
+// in-memory changes to them are reapplied to the re-read virtual machine.
+func (v *azureVolumeSource) refreshVirtualMachine(instanceId instance.Id, vm *maybeVirtualMachine) error {
+	latest, etag, err := v.getVirtualMachine(instanceId)
+	if err != nil {
+		return errors.Annotate(err, "getting virtual machine")
+	}
+	dataDisks := copyDataDisks(latest)
+	if !reflect.DeepEqual(dataDisks, vm.dataDisks) {
+		logger.Debugf("data disks of instance %v were modified concurrently", instanceId)
+		if err := rebaseDataDisks(latest, vm.dataDisks, vm.vm); err != nil {
+			return errors.Annotatef(err, "updating instance %v", instanceId)
+		}
+		vm.vm = latest
+	}
+	vm.etag, vm.dataDisks = etag, dataDisks
+	return nil
+}
+
+// createOrUpdateVirtualMachineIfMatch creates or updates the given virtual
+// machine. If etag is non-empty, the request is conditional on the virtual
+// machine's entity tag matching it.
+func createOrUpdateVirtualMachineIfMatch(
+	client compute.VirtualMachinesClient,
+	resourceGroup string,
+	vm compute.VirtualMachine,
+	etag string,
+) (autorest.Response, error) {
+	req, err := client.CreateOrUpdatePreparer(
+		resourceGroup, to.String(vm.Name), vm,
+		nil, // abort channel
+	)
+	if err != nil {
+		return autorest.Response{}, errors.Trace(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	resp, err := client.CreateOrUpdateSender(req)
+	if err != nil {
+		return autorest.Response{Response: resp}, err
+	}
+	return client.CreateOrUpdateResponder(resp)
+}
+
+// virtualMachineConflictError is returned when a virtual machine could
+// not be updated because it was repeatedly modified concurrently.
+type virtualMachineConflictError struct {
+	instanceId instance.Id
+}
+
+func (e *virtualMachineConflictError) Error() string {
+	return fmt.Sprintf("updating instance %v: instance was modified concurrently", e.instanceId)
+}
+
+// isVirtualMachineConflict reports whether or not the cause of
+// the given error is a *virtualMachineConflictError.
+func isVirtualMachineConflict(err error) bool {
+	_, ok := errors.Cause(err).(*virtualMachineConflictError)
+	return ok
+}
+
+// copyDataDisks returns a copy of the given virtual machine's data disks.
+func copyDataDisks(vm *compute.VirtualMachine) []compute.DataDisk {
+	if vm.Properties == nil || vm.Properties.StorageProfile == nil {
+		return nil
+	}
+	if vm.Properties.StorageProfile.DataDisks == nil {
+		return nil
+	}
+	return append([]compute.DataDisk(nil), *vm.Properties.StorageProfile.DataDisks...)
+}
+
+// rebaseDataDisks applies the changes made to the data disks of modified,
+// relative to the data disks in original, to the data disks of latest.
+// Disks are identified by name. An error is returned if a disk to be added
+// has a LUN that is now in use by another disk.
+func rebaseDataDisks(latest *compute.VirtualMachine, original []compute.DataDisk, modified *compute.VirtualMachine) error {
+	if latest.Properties == nil || latest.Properties.StorageProfile == nil {
+		return errors.New("virtual machine has no storage profile")
+	}
+	wasAttached := make(map[string]bool)
+	for _, disk := range original {
+		wasAttached[to.String(disk.Name)] = true
+	}
+	isAttached := make(map[string]bool)
+	for _, disk := range copyDataDisks(modified) {
+		isAttached[to.String(disk.Name)] = true
+	}
+
+	var dataDisks []compute.DataDisk
+	var luns [maxLUN + 1]bool
+	present := make(map[string]bool)
+	for _, disk := range copyDataDisks(latest) {
+		name := to.String(disk.Name)
+		if wasAttached[name] && !isAttached[name] {
+			// Detached in-memory.
+			continue
+		}
+		if lun := to.Int32(disk.Lun); lun >= 0 && lun <= maxLUN {
+			luns[lun] = true
+		}
+		present[name] = true
+		dataDisks = append(dataDisks, disk)
+	}
+	for _, disk := range copyDataDisks(modified) {
+		name := to.String(disk.Name)
+		if wasAttached[name] || present[name] {
+			continue
+		}
+		// Attached in-memory.
+		lun := to.Int32(disk.Lun)
+		if lun >= 0 && lun <= maxLUN && luns[lun] {
+			return errors.Errorf("LUN %d for disk %q is now in use", lun, name)
+		}
+		dataDisks = append(dataDisks, disk)
+	}
+	if len(dataDisks) == 0 {
+		latest.Properties.StorageProfile.DataDisks = nil
+	} else {
+		latest.Properties.StorageProfile.DataDisks = &dataDisks
+	}
+	return nil
+}
+
+// maxDataDisks returns the maximum number of data disks that may be
+// attached to the given virtual machine, according to its size. If the
+// limit for the size cannot be determined, defaultMaxDataDisks is
+// returned.
+func (v *azureVolumeSource) maxDataDisks(vm *compute.VirtualMachine) int32 {
+	if vm.Properties == nil || vm.Properties.HardwareProfile == nil {
+		return defaultMaxDataDisks
+	}
+	vmSize := string(vm.Properties.HardwareProfile.VMSize)
+	if vmSize == "" {
+		return defaultMaxDataDisks
+	}
+	count, err := v.env.getMaxDataDiskCount(vmSize)
+	if err != nil {
+		logger.Debugf("using default data disk limit for %q: %v", to.String(vm.Name), err)
+		return defaultMaxDataDisks
+	}
+	if count > maxLUN+1 {
+		count = maxLUN + 1
+	}
+	return count
+}
+
+// nextAvailableLUN returns the lowest LUN below maxDataDisks that is not
+// in use by the given virtual machine, or errAllLUNsInUse if there is
+// none.
+func nextAvailableLUN(vm *compute.VirtualMachine, maxDataDisks int32) (int32, error) {
 	// Pick the smallest LUN not in use. We have to choose them in order,
 	// or the disks don't show up.
-	var inUse [32]bool
+	for i, inUse := range lunsInUse(vm) {
+		if int32(i) >= maxDataDisks {
+			break
+		}
+		if !inUse {
+			return int32(i), nil
+		}
+	}
+	return -1, errAllLUNsInUse
+}
+
+// chooseLUN returns the LUN to attach a new data disk to the given
+// virtual machine with. If lun is non-nil, it is returned if free;
+// otherwise the lowest free LUN is chosen. LUNs at or above
+// maxDataDisks are never returned.
+func chooseLUN(vm *compute.VirtualMachine, lun *int32, maxDataDisks int32) (int32, error) {
+	if lun == nil {
+		return nextAvailableLUN(vm, maxDataDisks)
+	}
+	if *lun >= maxDataDisks {
+		return -1, errors.NotValidf(
+			"LUN %d (instance supports at most %d data disks)",
+			*lun, maxDataDisks,
+		)
+	}
+	inUse := lunsInUse(vm)
+	if inUse[*lun] {
+		if _, err := nextAvailableLUN(vm, maxDataDisks); err != nil {
+			return -1, errors.Trace(err)
+		}
+		return -1, errors.AlreadyExistsf("LUN %d", *lun)
+	}
+	return *lun, nil
+}
+
+// lunsInUse reports, for each valid LUN, whether a data disk is
+// attached to the virtual machine with that LUN.
+func lunsInUse(vm *compute.VirtualMachine) [maxLUN + 1]bool {
+	var inUse [maxLUN + 1]bool
 	if vm.Properties.StorageProfile.DataDisks != nil {
 		for _, disk := range *vm.Properties.StorageProfile.DataDisks {
 			lun := to.Int32(disk.Lun)
-			if lun < 0 || lun > 31 {
+			if lun < 0 || lun > maxLUN {
 				logger.Debugf("ignore disk with invalid LUN: %+v", disk)
 				continue
 			}
 			inUse[lun] = true
 		}
 	}
-	for i, inUse := range inUse {
-		if !inUse {
-			return int32(i), nil
-		}
-	}
-	return -1, errors.New("all LUNs are in use")
+	return inUse
 }
 
 // diskBusAddress returns the value to use in the BusAddress field of
@@ -717,6 +1490,37 @@ func blobVolumeId(blob azurestorage.Blob) (string, bool) {
 	return volumeId, true
 }
 
+// blobURIVolumeId returns the ID of the imported volume backed by the
+// blob with the given URI, which must be in the storage account.
+func blobURIVolumeId(storageAccount *armstorage.Account, blobURI string) (string, error) {
+	blobEndpoint := to.String(storageAccount.Properties.PrimaryEndpoints.Blob)
+	if !strings.HasPrefix(blobURI, blobEndpoint) {
+		return "", errors.NotValidf(
+			"blob URI %q (expected a blob in %q)",
+			blobURI, blobEndpoint,
+		)
+	}
+	volumeId := blobURI[len(blobEndpoint):]
+	i := strings.Index(volumeId, "/")
+	if i < 0 {
+		return "", errors.NotValidf(
+			"blob URI %q (expected \"%s<container>/<blob>\")",
+			blobURI, blobEndpoint,
+		)
+	}
+	if err := validateImportedBlob(volumeId[:i], volumeId[i+1:]); err != nil {
+		return "", errors.Trace(err)
+	}
+	return volumeId, nil
+}
+
+// blobMetadataKey returns the given tag name in a form suitable for use
+// as a blob metadata key. Metadata keys must be valid C# identifiers, so
+// hyphens are replaced with underscores.
+func blobMetadataKey(tag string) string {
+	return strings.Replace(tag, "-", "_", -1)
+}
+
 // getStorageClient returns a new storage client, given an environ config
 // and a constructor.
 func getStorageClient(
@@ -4,14 +4,19 @@
 package azure_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/arm/compute"
 	armstorage "github.com/Azure/azure-sdk-for-go/arm/storage"
 	azurestorage "github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/mocks"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/juju/errors"
+	gitjujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 	"gopkg.in/juju/names.v2"
@@ -31,6 +36,7 @@ type storageSuite struct {
 	provider      storage.Provider
 	requests      []*http.Request
 	sender        azuretesting.Senders
+	retryClock    mockClock
 }
 
 var _ = gc.Suite(&storageSuite{})
@@ -39,23 +45,37 @@ func (s *storageSuite) SetUpTest(c *gc.C) {
 	s.BaseSuite.SetUpTest(c)
 	s.storageClient = azuretesting.MockStorageClient{}
 	s.requests = nil
-	envProvider := newProvider(c, azure.ProviderConfig{
-		Sender:                            &s.sender,
-		NewStorageClient:                  s.storageClient.NewClient,
-		RequestInspector:                  azuretesting.RequestRecorder(&s.requests),
-		RandomWindowsAdminPassword:        func() string { return "sorandom" },
-		InteractiveCreateServicePrincipal: azureauth.InteractiveCreateServicePrincipal,
-	})
+	s.retryClock = mockClock{Clock: gitjujutesting.NewClock(time.Time{})}
+	// Virtual machines are read one at a time, so that the
+	// requests are made in the order the senders expect.
+	s.PatchValue(azure.MaxConcurrentVirtualMachineRequests, 1)
+	s.provider = s.newStorageProvider(c, azure.ProviderConfig{})
+}
+
+func (s *storageSuite) newStorageProvider(c *gc.C, config azure.ProviderConfig) storage.Provider {
+	config.Sender = &s.sender
+	config.NewStorageClient = s.storageClient.NewClient
+	config.RequestInspector = azuretesting.RequestRecorder(&s.requests)
+	config.RetryClock = &gitjujutesting.AutoAdvancingClock{
+		&s.retryClock, s.retryClock.Advance,
+	}
+	config.RandomWindowsAdminPassword = func() string { return "sorandom" }
+	config.InteractiveCreateServicePrincipal = azureauth.InteractiveCreateServicePrincipal
+	envProvider := newProvider(c, config)
 	s.sender = nil
 
-	var err error
 	env := openEnviron(c, envProvider, &s.sender)
-	s.provider, err = env.StorageProvider("azure")
+	provider, err := env.StorageProvider("azure")
 	c.Assert(err, jc.ErrorIsNil)
+	return provider
 }
 
 func (s *storageSuite) volumeSource(c *gc.C, attrs ...testing.Attrs) storage.VolumeSource {
-	storageConfig, err := storage.NewConfig("azure", "azure", nil)
+	var poolAttrs map[string]interface{}
+	if len(attrs) > 0 {
+		poolAttrs = attrs[0]
+	}
+	storageConfig, err := storage.NewConfig("azure", "azure", poolAttrs)
 	c.Assert(err, jc.ErrorIsNil)
 
 	volumeSource, err := s.provider.VolumeSource(storageConfig)
@@ -186,18 +206,17 @@ func (s *storageSuite) TestCreateVolumes(c *gc.C) {
 		},
 	}}
 
-	// There should be a one API calls to list VMs, and one update per modified instance.
-	virtualMachinesSender := azuretesting.NewSenderWithValue(compute.VirtualMachineListResult{
-		Value: &virtualMachines,
-	})
-	virtualMachinesSender.PathPattern = `.*/Microsoft\.Compute/virtualMachines`
+	// There should be one API call to get each VM, and one update per modified instance.
 	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
 	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
 	updateVirtualMachine1Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
 	updateVirtualMachine1Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-1`
 	volumeSource := s.volumeSource(c)
 	s.sender = azuretesting.Senders{
-		virtualMachinesSender,
+		virtualMachineSender(virtualMachines[0], "etag-0"),
+		virtualMachineSender(virtualMachines[1], "etag-0"),
+		virtualMachineNotFoundSender("machine-42"),
+		virtualMachineSender(virtualMachines[2], "etag-0"),
 		s.accountSender(),
 		updateVirtualMachine0Sender,
 		updateVirtualMachine1Sender,
@@ -214,11 +233,13 @@ func (s *storageSuite) TestCreateVolumes(c *gc.C) {
 	c.Check(results[4].Error, gc.ErrorMatches, "choosing LUN: all LUNs are in use")
 
 	// Validate HTTP request bodies.
-	c.Assert(s.requests, gc.HasLen, 4)
-	c.Assert(s.requests[0].Method, gc.Equals, "GET") // list virtual machines
-	c.Assert(s.requests[1].Method, gc.Equals, "GET") // list storage accounts
-	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
-	c.Assert(s.requests[3].Method, gc.Equals, "PUT") // update machine-1
+	c.Assert(s.requests, gc.HasLen, 7)
+	for _, req := range s.requests[:4] {
+		c.Assert(req.Method, gc.Equals, "GET") // get virtual machines
+	}
+	c.Assert(s.requests[4].Method, gc.Equals, "GET") // list storage accounts
+	c.Assert(s.requests[5].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests[6].Method, gc.Equals, "PUT") // update machine-1
 
 	machine0DataDisks := []compute.DataDisk{{
 		Lun:        to.Int32Ptr(0),
@@ -242,7 +263,7 @@ func (s *storageSuite) TestCreateVolumes(c *gc.C) {
 		CreateOption: compute.Empty,
 	}}
 	virtualMachines[0].Properties.StorageProfile.DataDisks = &machine0DataDisks
-	assertRequestBody(c, s.requests[2], &virtualMachines[0])
+	assertRequestBody(c, s.requests[5], &virtualMachines[0])
 
 	machine1DataDisks = append(machine1DataDisks, compute.DataDisk{
 		Lun:        to.Int32Ptr(1),
@@ -255,260 +276,1339 @@ func (s *storageSuite) TestCreateVolumes(c *gc.C) {
 		Caching:      compute.ReadWrite,
 		CreateOption: compute.Empty,
 	})
-	assertRequestBody(c, s.requests[3], &virtualMachines[1])
+	assertRequestBody(c, s.requests[6], &virtualMachines[1])
 }
 
-func (s *storageSuite) TestListVolumes(c *gc.C) {
-	s.storageClient.ListBlobsFunc = func(
-		container string,
-		params azurestorage.ListBlobsParameters,
-	) (azurestorage.BlobListResponse, error) {
-		return azurestorage.BlobListResponse{
-			Blobs: []azurestorage.Blob{{
-				Name: "volume-1.vhd",
-				Properties: azurestorage.BlobProperties{
-					ContentLength: 1024 * 1024, // 1MiB
-				},
-			}, {
-				Name: "volume-0.vhd",
-				Properties: azurestorage.BlobProperties{
-					ContentLength: 1024 * 1024 * 1024 * 1024, // 1TiB
+func (s *storageSuite) TestCreateVolumesWithObserver(c *gc.C) {
+	makeVolumeParams := func(volume string, size uint64) storage.VolumeParams {
+		return storage.VolumeParams{
+			Tag:      names.NewVolumeTag(volume),
+			Size:     size,
+			Provider: "azure",
+			Attachment: &storage.VolumeAttachmentParams{
+				AttachmentParams: storage.AttachmentParams{
+					Provider:   "azure",
+					Machine:    names.NewMachineTag("0"),
+					InstanceId: "machine-0",
 				},
-			}, {
-				Name: "junk.vhd",
-			}, {
-				Name: "volume",
-			}},
-		}, nil
+				Volume: names.NewVolumeTag(volume),
+			},
+		}
+	}
+	params := []storage.VolumeParams{
+		makeVolumeParams("0", 1024),
+		makeVolumeParams("1", 1024*1024*1024), // too large
+		makeVolumeParams("2", 1024),
 	}
 
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
 	volumeSource := s.volumeSource(c)
-	s.sender = azuretesting.Senders{
-		s.accountSender(),
-		s.accountKeysSender(),
-	}
-	volumeIds, err := volumeSource.ListVolumes()
-	c.Assert(err, jc.ErrorIsNil)
-	s.storageClient.CheckCallNames(c, "NewClient", "ListBlobs")
-	s.storageClient.CheckCall(
-		c, 0, "NewClient", storageAccountName, fakeStorageAccountKey,
-		"storage.azurestack.local", azurestorage.DefaultAPIVersion, true,
+	s.sender = s.createVolumeSenders(updateVirtualMachine0Sender)
+
+	var observed []int
+	observedResults := make(map[int]storage.CreateVolumesResult)
+	results, err := volumeSource.(storage.ObservingVolumeCreator).CreateVolumesWithObserver(
+		params, func(i int, result storage.CreateVolumesResult) {
+			observed = append(observed, i)
+			observedResults[i] = result
+		},
 	)
-	s.storageClient.CheckCall(c, 1, "ListBlobs", "datavhds", azurestorage.ListBlobsParameters{})
-	c.Assert(volumeIds, jc.DeepEquals, []string{"volume-1", "volume-0"})
-}
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, len(params))
+	c.Check(results[0].Error, jc.ErrorIsNil)
+	c.Check(results[1].Error, gc.ErrorMatches, "1048576 GiB exceeds the maximum of 1023 GiB")
+	c.Check(results[2].Error, jc.ErrorIsNil)
 
-func (s *storageSuite) TestListVolumesErrors(c *gc.C) {
-	volumeSource := s.volumeSource(c)
-	s.sender = azuretesting.Senders{
-		s.accountSender(),
-		s.accountKeysSender(),
+	// The invalid volume is observed first, and then the others
+	// once the virtual machine has been updated.
+	c.Assert(observed, jc.DeepEquals, []int{1, 0, 2})
+	for i, result := range results {
+		c.Check(observedResults[i], jc.DeepEquals, result)
 	}
+}
 
-	s.storageClient.SetErrors(errors.New("no client for you"))
-	_, err := volumeSource.ListVolumes()
-	c.Assert(err, gc.ErrorMatches, "listing volumes: getting storage client: no client for you")
+func (s *storageSuite) TestCreateVolumesWithObserverUpdateFailed(c *gc.C) {
+	updateSender := mocks.NewSender()
+	updateSender.AppendResponse(mocks.NewResponseWithBodyAndStatus(
+		mocks.NewBody("{}"), http.StatusInternalServerError, "internal server error",
+	))
+	volumeSource := s.volumeSource(c)
+	s.sender = s.createVolumeSenders(updateSender)
 
-	s.storageClient.SetErrors(nil, errors.New("no blobs for you"))
-	_, err = volumeSource.ListVolumes()
-	c.Assert(err, gc.ErrorMatches, "listing volumes: listing blobs: no blobs for you")
+	var observed []storage.CreateVolumesResult
+	results, err := volumeSource.(storage.ObservingVolumeCreator).CreateVolumesWithObserver(
+		createVolumeParams(), func(i int, result storage.CreateVolumesResult) {
+			observed = append(observed, result)
+		},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.NotNil)
+	c.Assert(observed, gc.HasLen, 1)
+	c.Assert(observed[0].Error, gc.Equals, results[0].Error)
+	c.Assert(observed[0].Volume, gc.IsNil)
 }
 
-func (s *storageSuite) TestDescribeVolumes(c *gc.C) {
-	s.storageClient.ListBlobsFunc = func(
-		container string,
-		params azurestorage.ListBlobsParameters,
-	) (azurestorage.BlobListResponse, error) {
-		return azurestorage.BlobListResponse{
-			Blobs: []azurestorage.Blob{{
-				Name: "volume-1.vhd",
-				Properties: azurestorage.BlobProperties{
-					ContentLength: 1024 * 1024, // 1MiB
-				},
-			}, {
-				Name: "volume-0.vhd",
-				Properties: azurestorage.BlobProperties{
-					ContentLength: 1024 * 1024 * 1024 * 1024, // 1TiB
-				},
-			}},
-		}, nil
+func (s *storageSuite) createVolumeSenders(updateSenders ...autorest.Sender) azuretesting.Senders {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
 	}
-
-	volumeSource := s.volumeSource(c)
-	s.sender = azuretesting.Senders{
+	senders := azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
 		s.accountSender(),
-		s.accountKeysSender(),
 	}
-	results, err := volumeSource.DescribeVolumes([]string{"volume-0", "volume-1", "volume-0", "volume-42"})
-	c.Assert(err, jc.ErrorIsNil)
-	s.storageClient.CheckCallNames(c, "NewClient", "ListBlobs")
-	s.storageClient.CheckCall(
-		c, 0, "NewClient", storageAccountName, fakeStorageAccountKey,
-		"storage.azurestack.local", azurestorage.DefaultAPIVersion, true,
-	)
-	c.Assert(results, gc.HasLen, 4)
-	c.Assert(results[:3], jc.DeepEquals, []storage.DescribeVolumesResult{{
-		VolumeInfo: &storage.VolumeInfo{
-			VolumeId:   "volume-0",
-			Size:       1024 * 1024,
-			Persistent: true,
-		},
-	}, {
-		VolumeInfo: &storage.VolumeInfo{
-			VolumeId:   "volume-1",
-			Size:       1,
-			Persistent: true,
-		},
-	}, {
-		VolumeInfo: &storage.VolumeInfo{
-			VolumeId:   "volume-0",
-			Size:       1024 * 1024,
-			Persistent: true,
-		},
-	}})
-	c.Assert(results[3].Error, gc.ErrorMatches, "volume-42 not found")
+	return append(senders, updateSenders...)
 }
 
-func (s *storageSuite) TestDestroyVolumes(c *gc.C) {
-	volumeSource := s.volumeSource(c)
-	s.sender = azuretesting.Senders{
-		s.accountSender(),
-		s.accountKeysSender(),
+// virtualMachineSender returns a sender that responds to a request
+// to get the given virtual machine, reporting the given entity tag
+// if it is non-empty.
+func virtualMachineSender(vm compute.VirtualMachine, etag string) *azuretesting.MockSender {
+	content, err := json.Marshal(&vm)
+	if err != nil {
+		panic(err)
 	}
-	results, err := volumeSource.DestroyVolumes([]string{"volume-0", "volume-42"})
-	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(results, gc.HasLen, 2)
-	c.Assert(results[0], jc.ErrorIsNil)
-	c.Assert(results[1], jc.ErrorIsNil)
-	s.storageClient.CheckCallNames(c, "NewClient", "DeleteBlobIfExists", "DeleteBlobIfExists")
-	s.storageClient.CheckCall(c, 1, "DeleteBlobIfExists", "datavhds", "volume-0.vhd")
-	s.storageClient.CheckCall(c, 2, "DeleteBlobIfExists", "datavhds", "volume-42.vhd")
+	resp := mocks.NewResponseWithContent(string(content))
+	if etag != "" {
+		mocks.SetResponseHeader(resp, "ETag", etag)
+	}
+	sender := &azuretesting.MockSender{
+		Sender:      mocks.NewSender(),
+		PathPattern: `.*/Microsoft\.Compute/virtualMachines/` + to.String(vm.Name),
+	}
+	sender.AppendResponse(resp)
+	return sender
 }
 
-func (s *storageSuite) TestAttachVolumes(c *gc.C) {
-	// machine-1 has a single data disk with LUN 0.
-	machine1DataDisks := []compute.DataDisk{{
-		Lun:  to.Int32Ptr(0),
-		Name: to.StringPtr("volume-1"),
-		Vhd: &compute.VirtualHardDisk{
-			URI: to.StringPtr(fmt.Sprintf(
-				"https://%s.blob.storage.azurestack.local/datavhds/volume-1.vhd",
-				storageAccountName,
-			)),
-		},
-	}}
-	// machine-2 has 32 data disks; no LUNs free.
-	machine2DataDisks := make([]compute.DataDisk, 32)
-	for i := range machine2DataDisks {
-		machine2DataDisks[i].Lun = to.Int32Ptr(int32(i))
-		machine2DataDisks[i].Name = to.StringPtr(fmt.Sprintf("volume-%d", i))
-		machine2DataDisks[i].Vhd = &compute.VirtualHardDisk{
-			URI: to.StringPtr(fmt.Sprintf(
-				"https://%s.blob.storage.azurestack.local/datavhds/volume-%d.vhd",
-				storageAccountName, i,
-			)),
-		}
+// virtualMachineNotFoundSender returns a sender that responds to a
+// request to get the named virtual machine with a 404 Not Found.
+func virtualMachineNotFoundSender(name string) *azuretesting.MockSender {
+	sender := &azuretesting.MockSender{
+		Sender:      mocks.NewSender(),
+		PathPattern: `.*/Microsoft\.Compute/virtualMachines/` + name,
 	}
+	sender.AppendResponse(mocks.NewResponseWithBodyAndStatus(
+		mocks.NewBody("{}"), http.StatusNotFound, "not found",
+	))
+	return sender
+}
 
-	// volume-0 and volume-2 are attached to machine-0
-	// volume-1 is attached to machine-1
-	// volume-3 is attached to machine-42, but machine-42 is missing
-	// volume-42 is attached to machine-2, but machine-2 has no free LUNs
-	makeParams := func(volume, machine string, size uint64) storage.VolumeAttachmentParams {
-		return storage.VolumeAttachmentParams{
+// preconditionFailedSender returns a sender that responds to a
+// request with a 412 Precondition Failed.
+func preconditionFailedSender() *mocks.Sender {
+	sender := mocks.NewSender()
+	sender.AppendResponse(mocks.NewResponseWithBodyAndStatus(
+		mocks.NewBody("{}"), http.StatusPreconditionFailed, "precondition failed",
+	))
+	return sender
+}
+
+func rateLimitedSender(retryAfter string) *mocks.Sender {
+	resp := mocks.NewResponseWithBodyAndStatus(
+		mocks.NewBody("{}"), // empty JSON response to appease go-autorest
+		http.StatusTooManyRequests,
+		"(」゜ロ゜)」",
+	)
+	if retryAfter != "" {
+		mocks.SetResponseHeaderValues(resp, "Retry-After", []string{retryAfter})
+	}
+	sender := mocks.NewSender()
+	sender.AppendResponse(resp)
+	return sender
+}
+
+func createVolumeParams() []storage.VolumeParams {
+	return []storage.VolumeParams{{
+		Tag:      names.NewVolumeTag("0"),
+		Size:     1,
+		Provider: "azure",
+		Attachment: &storage.VolumeAttachmentParams{
 			AttachmentParams: storage.AttachmentParams{
 				Provider:   "azure",
-				Machine:    names.NewMachineTag(machine),
-				InstanceId: instance.Id("machine-" + machine),
+				Machine:    names.NewMachineTag("0"),
+				InstanceId: instance.Id("machine-0"),
 			},
-			Volume:   names.NewVolumeTag(volume),
-			VolumeId: "volume-" + volume,
-		}
-	}
-	params := []storage.VolumeAttachmentParams{
-		makeParams("0", "0", 1),
-		makeParams("1", "1", 1025),
-		makeParams("2", "0", 1024),
-		makeParams("3", "42", 40),
-		makeParams("42", "2", 50),
-	}
-
-	virtualMachines := []compute.VirtualMachine{{
-		Name: to.StringPtr("machine-0"),
-		Properties: &compute.VirtualMachineProperties{
-			StorageProfile: &compute.StorageProfile{},
-		},
-	}, {
-		Name: to.StringPtr("machine-1"),
-		Properties: &compute.VirtualMachineProperties{
-			StorageProfile: &compute.StorageProfile{DataDisks: &machine1DataDisks},
-		},
-	}, {
-		Name: to.StringPtr("machine-2"),
-		Properties: &compute.VirtualMachineProperties{
-			StorageProfile: &compute.StorageProfile{DataDisks: &machine2DataDisks},
+			Volume: names.NewVolumeTag("0"),
 		},
 	}}
+}
 
-	// There should be a one API calls to list VMs, and one update per modified instance.
-	virtualMachinesSender := azuretesting.NewSenderWithValue(compute.VirtualMachineListResult{
-		Value: &virtualMachines,
-	})
-	virtualMachinesSender.PathPattern = `.*/Microsoft\.Compute/virtualMachines`
+func (s *storageSuite) TestCreateVolumesTooManyRequests(c *gc.C) {
 	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
 	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
 	volumeSource := s.volumeSource(c)
-	s.sender = azuretesting.Senders{
-		virtualMachinesSender,
-		s.accountSender(),
+	s.sender = s.createVolumeSenders(
+		rateLimitedSender(""),
+		rateLimitedSender("30"),
 		updateVirtualMachine0Sender,
-	}
+	)
 
-	results, err := volumeSource.AttachVolumes(params)
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
 	c.Assert(err, jc.ErrorIsNil)
-	c.Assert(results, gc.HasLen, len(params))
-
-	c.Check(results[0].Error, jc.ErrorIsNil)
-	c.Check(results[1].Error, jc.ErrorIsNil)
-	c.Check(results[2].Error, jc.ErrorIsNil)
-	c.Check(results[3].Error, gc.ErrorMatches, "instance machine-42 not found")
-	c.Check(results[4].Error, gc.ErrorMatches, "choosing LUN: all LUNs are in use")
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
 
-	// Validate HTTP request bodies.
-	c.Assert(s.requests, gc.HasLen, 3)
-	c.Assert(s.requests[0].Method, gc.Equals, "GET") // list virtual machines
-	c.Assert(s.requests[1].Method, gc.Equals, "GET") // list storage accounts
-	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests, gc.HasLen, 5)
+	for _, req := range s.requests[2:] {
+		c.Assert(req.Method, gc.Equals, "PUT") // update machine-0
+	}
 
-	machine0DataDisks := []compute.DataDisk{{
-		Lun:  to.Int32Ptr(0),
-		Name: to.StringPtr("volume-0"),
-		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
-			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
-			storageAccountName,
-		))},
-		Caching:      compute.ReadWrite,
-		CreateOption: compute.Attach,
-	}, {
-		Lun:  to.Int32Ptr(1),
-		Name: to.StringPtr("volume-2"),
-		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
-			"https://%s.blob.storage.azurestack.local/datavhds/volume-2.vhd",
-			storageAccountName,
-		))},
-		Caching:      compute.ReadWrite,
-		CreateOption: compute.Attach,
-	}}
-	virtualMachines[0].Properties.StorageProfile.DataDisks = &machine0DataDisks
-	assertRequestBody(c, s.requests[2], &virtualMachines[0])
+	// The first retry uses the standard backoff; the second
+	// waits for as long as the Retry-After header requested.
+	s.retryClock.CheckCalls(c, []gitjujutesting.StubCall{
+		{"After", []interface{}{5 * time.Second}},
+		{"After", []interface{}{30 * time.Second}},
+	})
 }
 
-func (s *storageSuite) TestDetachVolumes(c *gc.C) {
-	// machine-0 has a three data disks: volume-0, volume-1 and volume-2
-	machine0DataDisks := []compute.DataDisk{{
-		Lun:  to.Int32Ptr(0),
-		Name: to.StringPtr("volume-0"),
-		Vhd: &compute.VirtualHardDisk{
+func (s *storageSuite) TestCreateVolumesTooManyRequestsMaxAttempts(c *gc.C) {
+	s.provider = s.newStorageProvider(c, azure.ProviderConfig{
+		MaxRetryAttempts: 2,
+	})
+	volumeSource := s.volumeSource(c)
+	s.sender = s.createVolumeSenders(
+		rateLimitedSender(""),
+		rateLimitedSender(""),
+	)
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, "attempt count exceeded: .*")
+	c.Assert(s.requests, gc.HasLen, 4)
+	s.retryClock.CheckCalls(c, []gitjujutesting.StubCall{
+		{"After", []interface{}{5 * time.Second}},
+	})
+}
+
+func (s *storageSuite) TestCreateVolumesTooManyRequestsJitter(c *gc.C) {
+	// The jitter is added to the exponential backoff after it is
+	// capped at the maximum delay, and a longer Retry-After takes
+	// precedence over the jittered delay.
+	var jitterDelays []time.Duration
+	s.provider = s.newStorageProvider(c, azure.ProviderConfig{
+		RetryJitter: func(delay time.Duration) time.Duration {
+			jitterDelays = append(jitterDelays, delay)
+			return delay / 10
+		},
+	})
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = s.createVolumeSenders(
+		rateLimitedSender(""),
+		rateLimitedSender("30"),
+		rateLimitedSender("10"),
+		rateLimitedSender(""),
+		rateLimitedSender(""),
+		updateVirtualMachine0Sender,
+	)
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+	c.Assert(s.requests, gc.HasLen, 8)
+
+	c.Assert(jitterDelays, jc.DeepEquals, []time.Duration{
+		5 * time.Second,
+		10 * time.Second,
+		20 * time.Second,
+		40 * time.Second,
+		60 * time.Second,
+	})
+	s.retryClock.CheckCalls(c, []gitjujutesting.StubCall{
+		{"After", []interface{}{5500 * time.Millisecond}},
+		{"After", []interface{}{30 * time.Second}},
+		{"After", []interface{}{22 * time.Second}},
+		{"After", []interface{}{44 * time.Second}},
+		{"After", []interface{}{66 * time.Second}},
+	})
+}
+
+func (s *storageSuite) TestCreateVolumesExplicitLUN(c *gc.C) {
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = s.createVolumeSenders(updateVirtualMachine0Sender)
+
+	params := createVolumeParams()
+	params[0].Attributes = map[string]interface{}{"lun": 2}
+	results, err := volumeSource.CreateVolumes(params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+	c.Assert(results[0].VolumeAttachment.BusAddress, gc.Equals, "scsi@5:0.0.2")
+
+	c.Assert(s.requests, gc.HasLen, 3)
+	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
+	machine0DataDisks := []compute.DataDisk{{
+		Lun:        to.Int32Ptr(2),
+		DiskSizeGB: to.Int32Ptr(1),
+		Name:       to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Empty,
+	}}
+	assertRequestBody(c, s.requests[2], &compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &machine0DataDisks},
+		},
+	})
+}
+
+func (s *storageSuite) TestCreateVolumesExplicitLUNInUse(c *gc.C) {
+	// machine-0 has data disks with LUNs 0 and 1.
+	dataDisks := []compute.DataDisk{{Lun: to.Int32Ptr(0)}, {Lun: to.Int32Ptr(1)}}
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &dataDisks},
+		},
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+	}
+
+	params := createVolumeParams()
+	params[0].Attributes = map[string]interface{}{"lun": 1}
+	results, err := volumeSource.CreateVolumes(params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, "choosing LUN: LUN 1 already exists")
+	c.Assert(errors.Cause(results[0].Error), jc.Satisfies, errors.IsAlreadyExists)
+}
+
+// vmSizesSender returns a sender that responds to a request to list
+// VM sizes with sizes supporting 2 and 64 data disks.
+func vmSizesSender() *azuretesting.MockSender {
+	vmSizes := []compute.VirtualMachineSize{{
+		Name:             to.StringPtr("Standard_A1"),
+		MaxDataDiskCount: to.Int32Ptr(2),
+	}, {
+		Name:             to.StringPtr("Standard_G5"),
+		MaxDataDiskCount: to.Int32Ptr(64),
+	}}
+	sender := azuretesting.NewSenderWithValue(&compute.VirtualMachineSizeListResult{
+		Value: &vmSizes,
+	})
+	sender.PathPattern = ".*/vmSizes"
+	return sender
+}
+
+// sizedVirtualMachine returns a virtual machine of the given size,
+// with data disks attached at LUNs 0 to numDataDisks-1.
+func sizedVirtualMachine(vmSize string, numDataDisks int) compute.VirtualMachine {
+	dataDisks := make([]compute.DataDisk, numDataDisks)
+	for i := range dataDisks {
+		dataDisks[i].Lun = to.Int32Ptr(int32(i))
+	}
+	return compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			HardwareProfile: &compute.HardwareProfile{
+				VMSize: compute.VirtualMachineSizeTypes(vmSize),
+			},
+			StorageProfile: &compute.StorageProfile{DataDisks: &dataDisks},
+		},
+	}
+}
+
+func (s *storageSuite) TestCreateVolumesLargeVMSize(c *gc.C) {
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(sizedVirtualMachine("Standard_G5", 32), "etag-0"),
+		s.accountSender(),
+		vmSizesSender(),
+		updateVirtualMachine0Sender,
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+	c.Assert(results[0].VolumeAttachment.BusAddress, gc.Equals, "scsi@5:0.0.32")
+	c.Assert(s.requests, gc.HasLen, 4)
+	c.Assert(s.requests[3].Method, gc.Equals, "PUT") // update machine-0
+}
+
+func (s *storageSuite) TestCreateVolumesSmallVMSize(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(sizedVirtualMachine("Standard_A1", 2), "etag-0"),
+		s.accountSender(),
+		vmSizesSender(),
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, "choosing LUN: all LUNs are in use")
+	c.Assert(s.requests, gc.HasLen, 3)
+}
+
+func (s *storageSuite) TestCreateVolumesExplicitLUNExceedsVMSize(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(sizedVirtualMachine("Standard_A1", 0), "etag-0"),
+		s.accountSender(),
+		vmSizesSender(),
+	}
+
+	params := createVolumeParams()
+	params[0].Attributes = map[string]interface{}{"lun": 2}
+	results, err := volumeSource.CreateVolumes(params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches,
+		`choosing LUN: LUN 2 \(instance supports at most 2 data disks\) not valid`,
+	)
+}
+
+func (s *storageSuite) TestCreateVolumesUnknownVMSize(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(sizedVirtualMachine("Standard_Unknown", 32), "etag-0"),
+		s.accountSender(),
+		vmSizesSender(),
+	}
+
+	// The limit for unknown sizes defaults to 32 data disks.
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, "choosing LUN: all LUNs are in use")
+}
+
+func (s *storageSuite) TestCreateVolumesConcurrentUpdate(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	// Between reading and updating machine-0, another
+	// disk is attached to it with LUN 5.
+	otherDataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(5),
+		Name: to.StringPtr("other"),
+	}}
+	updatedVirtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &otherDataDisks},
+		},
+	}
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+		preconditionFailedSender(),
+		virtualMachineSender(updatedVirtualMachine, "etag-1"),
+		updateVirtualMachine0Sender,
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+
+	c.Assert(s.requests, gc.HasLen, 5)
+	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests[2].Header.Get("If-Match"), gc.Equals, "etag-0")
+	c.Assert(s.requests[3].Method, gc.Equals, "GET") // re-read machine-0
+	c.Assert(s.requests[4].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests[4].Header.Get("If-Match"), gc.Equals, "etag-1")
+
+	// The new disk is added alongside the concurrently attached one.
+	machine0DataDisks := []compute.DataDisk{otherDataDisks[0], {
+		Lun:        to.Int32Ptr(0),
+		DiskSizeGB: to.Int32Ptr(1),
+		Name:       to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Empty,
+	}}
+	updatedVirtualMachine.Properties.StorageProfile.DataDisks = &machine0DataDisks
+	assertRequestBody(c, s.requests[4], &updatedVirtualMachine)
+}
+
+func (s *storageSuite) TestCreateVolumesConcurrentUpdateMaxAttempts(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+		preconditionFailedSender(),
+		virtualMachineSender(virtualMachine, "etag-1"),
+		preconditionFailedSender(),
+		virtualMachineSender(virtualMachine, "etag-2"),
+		preconditionFailedSender(),
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, "updating instance machine-0: instance was modified concurrently")
+	c.Assert(results[0].Error, jc.Satisfies, azure.IsVirtualMachineConflict)
+	c.Assert(s.requests, gc.HasLen, 7)
+}
+
+func (s *storageSuite) TestCreateVolumesConcurrentUpdateLUNConflict(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	// Between reading and updating machine-0, another
+	// disk is attached to it with the LUN we chose.
+	otherDataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("other"),
+	}}
+	updatedVirtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &otherDataDisks},
+		},
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+		preconditionFailedSender(),
+		virtualMachineSender(updatedVirtualMachine, "etag-1"),
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, `updating instance machine-0: LUN 0 for disk "volume-0" is now in use`)
+	c.Assert(s.requests, gc.HasLen, 4)
+}
+
+func (s *storageSuite) TestCreateVolumesWithoutEntityTag(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, ""),
+		s.accountSender(),
+		virtualMachineSender(virtualMachine, ""),
+		updateVirtualMachine0Sender,
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+
+	// With no entity tag to make the update conditional on,
+	// the virtual machine is re-read before updating it.
+	c.Assert(s.requests, gc.HasLen, 4)
+	c.Assert(s.requests[2].Method, gc.Equals, "GET") // re-read machine-0
+	c.Assert(s.requests[3].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests[3].Header.Get("If-Match"), gc.Equals, "")
+
+	machine0DataDisks := []compute.DataDisk{{
+		Lun:        to.Int32Ptr(0),
+		DiskSizeGB: to.Int32Ptr(1),
+		Name:       to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Empty,
+	}}
+	virtualMachine.Properties.StorageProfile.DataDisks = &machine0DataDisks
+	assertRequestBody(c, s.requests[3], &virtualMachine)
+}
+
+func (s *storageSuite) TestCreateVolumesWithoutEntityTagConcurrentUpdate(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	// Between reading and updating machine-0, another
+	// disk is attached to it with LUN 5.
+	otherDataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(5),
+		Name: to.StringPtr("other"),
+	}}
+	updatedVirtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &otherDataDisks},
+		},
+	}
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, ""),
+		s.accountSender(),
+		virtualMachineSender(updatedVirtualMachine, ""),
+		updateVirtualMachine0Sender,
+	}
+
+	results, err := volumeSource.CreateVolumes(createVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+
+	c.Assert(s.requests, gc.HasLen, 4)
+	c.Assert(s.requests[2].Method, gc.Equals, "GET") // re-read machine-0
+	c.Assert(s.requests[3].Method, gc.Equals, "PUT") // update machine-0
+
+	// The new disk is added alongside the concurrently attached one.
+	machine0DataDisks := []compute.DataDisk{otherDataDisks[0], {
+		Lun:        to.Int32Ptr(0),
+		DiskSizeGB: to.Int32Ptr(1),
+		Name:       to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Empty,
+	}}
+	updatedVirtualMachine.Properties.StorageProfile.DataDisks = &machine0DataDisks
+	assertRequestBody(c, s.requests[3], &updatedVirtualMachine)
+}
+
+func (s *storageSuite) TestValidateVolumeParamsInvalidLUN(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	params := createVolumeParams()
+	params[0].Attributes = map[string]interface{}{"lun": 64}
+	err := volumeSource.ValidateVolumeParams(params[0])
+	c.Assert(err, gc.ErrorMatches, "lun 64 \\(must be between 0 and 63\\) not valid")
+}
+
+func (s *storageSuite) TestListVolumes(c *gc.C) {
+	s.storageClient.ListBlobsFunc = func(
+		container string,
+		params azurestorage.ListBlobsParameters,
+	) (azurestorage.BlobListResponse, error) {
+		return azurestorage.BlobListResponse{
+			Blobs: []azurestorage.Blob{{
+				Name: "volume-1.vhd",
+				Properties: azurestorage.BlobProperties{
+					ContentLength: 1024 * 1024, // 1MiB
+				},
+			}, {
+				Name: "volume-0.vhd",
+				Properties: azurestorage.BlobProperties{
+					ContentLength: 1024 * 1024 * 1024 * 1024, // 1TiB
+				},
+			}, {
+				Name: "junk.vhd",
+			}, {
+				Name: "volume",
+			}},
+		}, nil
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	volumeIds, err := volumeSource.ListVolumes()
+	c.Assert(err, jc.ErrorIsNil)
+	s.storageClient.CheckCallNames(c, "NewClient", "ListBlobs")
+	s.storageClient.CheckCall(
+		c, 0, "NewClient", storageAccountName, fakeStorageAccountKey,
+		"storage.azurestack.local", azurestorage.DefaultAPIVersion, true,
+	)
+	s.storageClient.CheckCall(c, 1, "ListBlobs", "datavhds", azurestorage.ListBlobsParameters{})
+	c.Assert(volumeIds, jc.DeepEquals, []string{"volume-1", "volume-0"})
+}
+
+func (s *storageSuite) TestListVolumesErrors(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+
+	s.storageClient.SetErrors(errors.New("no client for you"))
+	_, err := volumeSource.ListVolumes()
+	c.Assert(err, gc.ErrorMatches, "listing volumes: getting storage client: no client for you")
+
+	s.storageClient.SetErrors(nil, errors.New("no blobs for you"))
+	_, err = volumeSource.ListVolumes()
+	c.Assert(err, gc.ErrorMatches, "listing volumes: listing blobs: no blobs for you")
+}
+
+func (s *storageSuite) TestDescribeVolumes(c *gc.C) {
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		switch name {
+		case "volume-0.vhd":
+			return &azurestorage.BlobProperties{
+				BlobType:      azurestorage.BlobTypePage,
+				ContentLength: 1024 * 1024 * 1024 * 1024, // 1TiB
+			}, nil
+		case "volume-1.vhd":
+			return &azurestorage.BlobProperties{
+				BlobType:      azurestorage.BlobTypePage,
+				ContentLength: 1024 * 1024, // 1MiB
+			}, nil
+		}
+		return nil, azurestorage.AzureStorageServiceError{
+			StatusCode: http.StatusNotFound,
+			Code:       "BlobNotFound",
+		}
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	results, err := volumeSource.DescribeVolumes([]string{"volume-0", "volume-1", "volume-0", "volume-42"})
+	c.Assert(err, jc.ErrorIsNil)
+	s.storageClient.CheckCallNames(c,
+		"NewClient", "GetBlobProperties", "GetBlobProperties",
+		"GetBlobProperties", "GetBlobProperties",
+	)
+	s.storageClient.CheckCall(
+		c, 0, "NewClient", storageAccountName, fakeStorageAccountKey,
+		"storage.azurestack.local", azurestorage.DefaultAPIVersion, true,
+	)
+	c.Assert(results, gc.HasLen, 4)
+	c.Assert(results[:3], jc.DeepEquals, []storage.DescribeVolumesResult{{
+		VolumeInfo: &storage.VolumeInfo{
+			VolumeId:   "volume-0",
+			Size:       1024 * 1024,
+			Persistent: true,
+		},
+	}, {
+		VolumeInfo: &storage.VolumeInfo{
+			VolumeId:   "volume-1",
+			Size:       1,
+			Persistent: true,
+		},
+	}, {
+		VolumeInfo: &storage.VolumeInfo{
+			VolumeId:   "volume-0",
+			Size:       1024 * 1024,
+			Persistent: true,
+		},
+	}})
+	c.Assert(results[3].Error, gc.ErrorMatches, "volume-42 not found")
+	c.Assert(results[3].Error, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *storageSuite) TestDescribeVolumesPreservesOrder(c *gc.C) {
+	// The properties for volume-0 are not returned until those
+	// for volume-1 have been, so the results complete in the
+	// reverse of the order in which they were requested.
+	volume1Done := make(chan struct{})
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		switch name {
+		case "volume-0.vhd":
+			select {
+			case <-volume1Done:
+			case <-time.After(testing.LongWait):
+				c.Error("timed out waiting for volume-1 properties")
+			}
+			return &azurestorage.BlobProperties{
+				BlobType:      azurestorage.BlobTypePage,
+				ContentLength: 2 * 1024 * 1024,
+			}, nil
+		case "volume-1.vhd":
+			defer close(volume1Done)
+			return &azurestorage.BlobProperties{
+				BlobType:      azurestorage.BlobTypePage,
+				ContentLength: 1024 * 1024,
+			}, nil
+		}
+		return nil, errors.New("unexpected blob " + name)
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	results, err := volumeSource.DescribeVolumes([]string{"volume-0", "volume-1"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, jc.DeepEquals, []storage.DescribeVolumesResult{{
+		VolumeInfo: &storage.VolumeInfo{
+			VolumeId:   "volume-0",
+			Size:       2,
+			Persistent: true,
+		},
+	}, {
+		VolumeInfo: &storage.VolumeInfo{
+			VolumeId:   "volume-1",
+			Size:       1,
+			Persistent: true,
+		},
+	}})
+}
+
+func (s *storageSuite) TestDescribeVolumesNonPersistent(c *gc.C) {
+	// A blob that is not a page blob cannot back a disk, so
+	// it is not reported as persistent storage.
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return &azurestorage.BlobProperties{
+			BlobType:      azurestorage.BlobTypeBlock,
+			ContentLength: 1024 * 1024,
+		}, nil
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	results, err := volumeSource.DescribeVolumes([]string{"volume-0"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, jc.DeepEquals, []storage.DescribeVolumesResult{{
+		VolumeInfo: &storage.VolumeInfo{
+			VolumeId:   "volume-0",
+			Size:       1,
+			Persistent: false,
+		},
+	}})
+}
+
+func (s *storageSuite) TestImportVolumeDescribeVolumesRoundTrip(c *gc.C) {
+	// The metadata set when importing a volume is stored on the
+	// blob, and the volume is described just as it was imported.
+	var metadata map[string]string
+	s.storageClient.SetBlobMetadataFunc = func(container, name string, md map[string]string) error {
+		metadata = md
+		return nil
+	}
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		c.Check(container, gc.Equals, "mydisks")
+		c.Check(name, gc.Equals, "data/disk.vhd")
+		return &azurestorage.BlobProperties{
+			BlobType:      azurestorage.BlobTypePage,
+			ContentLength: 2 * 1024 * 1024 * 1024, // 2GiB
+		}, nil
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	blobURI := fmt.Sprintf(
+		"https://%s.blob.storage.azurestack.local/mydisks/data/disk.vhd",
+		storageAccountName,
+	)
+	imported, err := volumeSource.(storage.VolumeImporter).ImportVolume(
+		blobURI, map[string]string{"juju-controller-uuid": "foo"},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imported.VolumeId, gc.Equals, "mydisks/data/disk.vhd")
+	c.Assert(metadata, jc.DeepEquals, map[string]string{
+		"juju_controller_uuid": "foo",
+		"juju_model_uuid":      testing.ModelTag.Id(),
+	})
+
+	results, err := volumeSource.DescribeVolumes([]string{imported.VolumeId})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+	c.Assert(*results[0].VolumeInfo, jc.DeepEquals, imported)
+}
+
+func (s *storageSuite) TestDescribeVolumesErrors(c *gc.C) {
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return nil, errors.New("no properties for you")
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	results, err := volumeSource.DescribeVolumes([]string{"machine-0", "volume-0"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 2)
+	c.Assert(results[0].Error, gc.ErrorMatches, `volume ID "machine-0" \(expected a data disk name\) not valid`)
+	c.Assert(results[1].Error, gc.ErrorMatches, `getting properties of volume "volume-0": no properties for you`)
+	s.storageClient.CheckCallNames(c, "NewClient", "GetBlobProperties")
+	s.storageClient.CheckCall(c, 1, "GetBlobProperties", "datavhds", "volume-0.vhd")
+}
+
+func (s *storageSuite) TestDestroyVolumes(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	results, err := volumeSource.DestroyVolumes([]string{"volume-0", "volume-42", "mydisks/disk.vhd"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 3)
+	c.Assert(results[0], jc.ErrorIsNil)
+	c.Assert(results[1], jc.ErrorIsNil)
+	c.Assert(results[2], jc.ErrorIsNil)
+	s.storageClient.CheckCallNames(c, "NewClient", "DeleteBlobIfExists", "DeleteBlobIfExists", "DeleteBlobIfExists")
+	s.storageClient.CheckCall(c, 1, "DeleteBlobIfExists", "datavhds", "volume-0.vhd")
+	s.storageClient.CheckCall(c, 2, "DeleteBlobIfExists", "datavhds", "volume-42.vhd")
+	s.storageClient.CheckCall(c, 3, "DeleteBlobIfExists", "mydisks", "disk.vhd")
+}
+
+func (s *storageSuite) TestDestroyVolumesInvalidVolumeId(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	results, err := volumeSource.DestroyVolumes([]string{"machine-0", "volume-0"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 2)
+	c.Assert(results[0], gc.ErrorMatches, `volume ID "machine-0" \(expected a data disk name\) not valid`)
+	c.Assert(results[1], jc.ErrorIsNil)
+	s.storageClient.CheckCallNames(c, "NewClient", "DeleteBlobIfExists")
+	s.storageClient.CheckCall(c, 1, "DeleteBlobIfExists", "datavhds", "volume-0.vhd")
+}
+
+func (s *storageSuite) TestImportVolume(c *gc.C) {
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return &azurestorage.BlobProperties{
+			BlobType:      azurestorage.BlobTypePage,
+			ContentLength: 2 * 1024 * 1024 * 1024, // 2GiB
+		}, nil
+	}
+
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	blobURI := fmt.Sprintf(
+		"https://%s.blob.storage.azurestack.local/mydisks/disk.vhd",
+		storageAccountName,
+	)
+	volumeInfo, err := volumeSource.(storage.VolumeImporter).ImportVolume(
+		blobURI, map[string]string{"juju-controller-uuid": "foo"},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(volumeInfo, jc.DeepEquals, storage.VolumeInfo{
+		VolumeId:   "mydisks/disk.vhd",
+		Size:       2 * 1024,
+		Persistent: true,
+	})
+	s.storageClient.CheckCallNames(c, "NewClient", "GetBlobProperties", "GetBlobMetadata", "SetBlobMetadata")
+	s.storageClient.CheckCall(c, 1, "GetBlobProperties", "mydisks", "disk.vhd")
+	s.storageClient.CheckCall(c, 2, "GetBlobMetadata", "mydisks", "disk.vhd")
+	s.storageClient.CheckCall(c, 3, "SetBlobMetadata", "mydisks", "disk.vhd", map[string]string{
+		"juju_controller_uuid": "foo",
+		"juju_model_uuid":      testing.ModelTag.Id(),
+	})
+}
+
+func (s *storageSuite) TestImportVolumeMergesMetadata(c *gc.C) {
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return &azurestorage.BlobProperties{BlobType: azurestorage.BlobTypePage}, nil
+	}
+	s.storageClient.GetBlobMetadataFunc = func(container, name string) (map[string]string, error) {
+		return map[string]string{"owner": "someone", "juju_controller_uuid": "old"}, nil
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	blobURI := fmt.Sprintf(
+		"https://%s.blob.storage.azurestack.local/mydisks/disk.vhd",
+		storageAccountName,
+	)
+	_, err := volumeSource.(storage.VolumeImporter).ImportVolume(
+		blobURI, map[string]string{"juju-controller-uuid": "foo"},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	s.storageClient.CheckCall(c, 3, "SetBlobMetadata", "mydisks", "disk.vhd", map[string]string{
+		"owner":                "someone",
+		"juju_controller_uuid": "foo",
+		"juju_model_uuid":      testing.ModelTag.Id(),
+	})
+}
+
+func (s *storageSuite) TestImportVolumeAlreadyManaged(c *gc.C) {
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return &azurestorage.BlobProperties{BlobType: azurestorage.BlobTypePage}, nil
+	}
+	s.storageClient.GetBlobMetadataFunc = func(container, name string) (map[string]string, error) {
+		return map[string]string{"juju_model_uuid": "other-model"}, nil
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	blobURI := fmt.Sprintf(
+		"https://%s.blob.storage.azurestack.local/mydisks/disk.vhd",
+		storageAccountName,
+	)
+	_, err := volumeSource.(storage.VolumeImporter).ImportVolume(blobURI, nil)
+	c.Assert(err, gc.ErrorMatches, `blob ".*/mydisks/disk.vhd" \(already managed by model "other-model"\) not valid`)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	s.storageClient.CheckCallNames(c, "NewClient", "GetBlobProperties", "GetBlobMetadata")
+}
+
+func (s *storageSuite) TestImportVolumeInvalidURI(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{s.accountSender()}
+	blobEndpoint := fmt.Sprintf("https://%s.blob.storage.azurestack.local/", storageAccountName)
+	for _, test := range []struct {
+		blobURI string
+		err     string
+	}{{
+		blobURI: "https://elsewhere.blob.core.windows.net/mydisks/disk.vhd",
+		err:     `blob URI ".*" \(expected a blob in ".*"\) not valid`,
+	}, {
+		blobURI: blobEndpoint + "volume-0",
+		err:     `blob URI ".*/volume-0" \(expected ".*<container>/<blob>"\) not valid`,
+	}, {
+		blobURI: blobEndpoint + "mydisks/",
+		err:     `blob "mydisks/" \(expected "<container>/<blob>"\) not valid`,
+	}, {
+		blobURI: blobEndpoint + "osvhds/machine-0.vhd",
+		err:     `blob "osvhds/machine-0.vhd" \(container "osvhds" holds OS disks\) not valid`,
+	}, {
+		blobURI: blobEndpoint + "datavhds/volume-0.vhd",
+		err: `blob "datavhds/volume-0.vhd" \(name is reserved for volumes created by Juju; ` +
+			`copy the blob to another name to import it\) not valid`,
+	}} {
+		_, err := volumeSource.(storage.VolumeImporter).ImportVolume(test.blobURI, nil)
+		c.Check(err, gc.ErrorMatches, test.err)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+	s.storageClient.CheckNoCalls(c)
+}
+
+func (s *storageSuite) TestImportVolumeDataDiskContainer(c *gc.C) {
+	// Blobs in the data-disk container may be imported, so long as
+	// they are not named like the volumes that Juju creates there.
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return &azurestorage.BlobProperties{BlobType: azurestorage.BlobTypePage}, nil
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	blobURI := fmt.Sprintf(
+		"https://%s.blob.storage.azurestack.local/datavhds/mydisk.vhd",
+		storageAccountName,
+	)
+	volumeInfo, err := volumeSource.(storage.VolumeImporter).ImportVolume(blobURI, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(volumeInfo.VolumeId, gc.Equals, "datavhds/mydisk.vhd")
+	s.storageClient.CheckCall(c, 1, "GetBlobProperties", "datavhds", "mydisk.vhd")
+}
+
+func (s *storageSuite) TestImportVolumeNotPageBlob(c *gc.C) {
+	s.storageClient.GetBlobPropertiesFunc = func(container, name string) (*azurestorage.BlobProperties, error) {
+		return &azurestorage.BlobProperties{BlobType: azurestorage.BlobTypeBlock}, nil
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		s.accountSender(),
+		s.accountKeysSender(),
+	}
+	blobURI := fmt.Sprintf(
+		"https://%s.blob.storage.azurestack.local/mydisks/disk.vhd",
+		storageAccountName,
+	)
+	_, err := volumeSource.(storage.VolumeImporter).ImportVolume(blobURI, nil)
+	c.Assert(err, gc.ErrorMatches, `blob ".*/mydisks/disk.vhd" with type "BlockBlob" \(VHDs must be page blobs\) not valid`)
+	s.storageClient.CheckCallNames(c, "NewClient", "GetBlobProperties")
+}
+
+func (s *storageSuite) TestAttachVolumes(c *gc.C) {
+	// machine-1 has a single data disk with LUN 0.
+	machine1DataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("volume-1"),
+		Vhd: &compute.VirtualHardDisk{
+			URI: to.StringPtr(fmt.Sprintf(
+				"https://%s.blob.storage.azurestack.local/datavhds/volume-1.vhd",
+				storageAccountName,
+			)),
+		},
+	}}
+	// machine-2 has 32 data disks; no LUNs free.
+	machine2DataDisks := make([]compute.DataDisk, 32)
+	for i := range machine2DataDisks {
+		machine2DataDisks[i].Lun = to.Int32Ptr(int32(i))
+		machine2DataDisks[i].Name = to.StringPtr(fmt.Sprintf("volume-%d", i))
+		machine2DataDisks[i].Vhd = &compute.VirtualHardDisk{
+			URI: to.StringPtr(fmt.Sprintf(
+				"https://%s.blob.storage.azurestack.local/datavhds/volume-%d.vhd",
+				storageAccountName, i,
+			)),
+		}
+	}
+
+	// volume-0 and volume-2 are attached to machine-0
+	// volume-1 is attached to machine-1
+	// volume-3 is attached to machine-42, but machine-42 is missing
+	// volume-42 is attached to machine-2, but machine-2 has no free LUNs
+	makeParams := func(volume, machine string, size uint64) storage.VolumeAttachmentParams {
+		return storage.VolumeAttachmentParams{
+			AttachmentParams: storage.AttachmentParams{
+				Provider:   "azure",
+				Machine:    names.NewMachineTag(machine),
+				InstanceId: instance.Id("machine-" + machine),
+			},
+			Volume:   names.NewVolumeTag(volume),
+			VolumeId: "volume-" + volume,
+		}
+	}
+	params := []storage.VolumeAttachmentParams{
+		makeParams("0", "0", 1),
+		makeParams("1", "1", 1025),
+		makeParams("2", "0", 1024),
+		makeParams("3", "42", 40),
+		makeParams("42", "2", 50),
+	}
+
+	virtualMachines := []compute.VirtualMachine{{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}, {
+		Name: to.StringPtr("machine-1"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &machine1DataDisks},
+		},
+	}, {
+		Name: to.StringPtr("machine-2"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &machine2DataDisks},
+		},
+	}}
+
+	// There should be one API call to get each VM, and one update per modified instance.
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachines[0], "etag-0"),
+		virtualMachineSender(virtualMachines[1], "etag-0"),
+		virtualMachineNotFoundSender("machine-42"),
+		virtualMachineSender(virtualMachines[2], "etag-0"),
+		s.accountSender(),
+		updateVirtualMachine0Sender,
+	}
+
+	results, err := volumeSource.AttachVolumes(params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, len(params))
+
+	c.Check(results[0].Error, jc.ErrorIsNil)
+	c.Check(results[1].Error, jc.ErrorIsNil)
+	c.Check(results[2].Error, jc.ErrorIsNil)
+	c.Check(results[3].Error, gc.ErrorMatches, "instance machine-42 not found")
+	c.Check(results[4].Error, gc.ErrorMatches, "choosing LUN: all LUNs are in use")
+
+	// Validate HTTP request bodies.
+	c.Assert(s.requests, gc.HasLen, 6)
+	for _, req := range s.requests[:4] {
+		c.Assert(req.Method, gc.Equals, "GET") // get virtual machines
+	}
+	c.Assert(s.requests[4].Method, gc.Equals, "GET") // list storage accounts
+	c.Assert(s.requests[5].Method, gc.Equals, "PUT") // update machine-0
+
+	machine0DataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Attach,
+	}, {
+		Lun:  to.Int32Ptr(1),
+		Name: to.StringPtr("volume-2"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-2.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Attach,
+	}}
+	virtualMachines[0].Properties.StorageProfile.DataDisks = &machine0DataDisks
+	assertRequestBody(c, s.requests[5], &virtualMachines[0])
+}
+
+func (s *storageSuite) TestAttachVolumesExplicitLUN(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c, testing.Attrs{"lun": 2})
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+		updateVirtualMachine0Sender,
+	}
+
+	makeParams := func(volume string) storage.VolumeAttachmentParams {
+		return storage.VolumeAttachmentParams{
+			AttachmentParams: storage.AttachmentParams{
+				Provider:   "azure",
+				Machine:    names.NewMachineTag("0"),
+				InstanceId: "machine-0",
+			},
+			Volume:   names.NewVolumeTag(volume),
+			VolumeId: "volume-" + volume,
+		}
+	}
+	// The pool's LUN applies to every volume in the pool, so
+	// only the first volume can be attached to machine-0.
+	results, err := volumeSource.AttachVolumes([]storage.VolumeAttachmentParams{
+		makeParams("0"), makeParams("1"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 2)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+	c.Assert(results[0].VolumeAttachment.BusAddress, gc.Equals, "scsi@5:0.0.2")
+	c.Assert(results[1].Error, gc.ErrorMatches, "choosing LUN: LUN 2 already exists")
+	c.Assert(errors.Cause(results[1].Error), jc.Satisfies, errors.IsAlreadyExists)
+
+	c.Assert(s.requests, gc.HasLen, 3)
+	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
+	machine0DataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(2),
+		Name: to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Attach,
+	}}
+	virtualMachine.Properties.StorageProfile.DataDisks = &machine0DataDisks
+	assertRequestBody(c, s.requests[2], &virtualMachine)
+}
+
+func (s *storageSuite) TestAttachVolumesImported(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+		updateVirtualMachine0Sender,
+	}
+
+	results, err := volumeSource.AttachVolumes([]storage.VolumeAttachmentParams{{
+		AttachmentParams: storage.AttachmentParams{
+			Provider:   "azure",
+			Machine:    names.NewMachineTag("0"),
+			InstanceId: "machine-0",
+		},
+		Volume:   names.NewVolumeTag("0"),
+		VolumeId: "mydisks/disk.vhd",
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, jc.ErrorIsNil)
+
+	// The imported volume's VHD is attached where it is, with
+	// a disk name derived from the volume ID.
+	c.Assert(s.requests, gc.HasLen, 3)
+	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
+	machine0DataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("imported-a9a2edb7683fea33"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/mydisks/disk.vhd",
+			storageAccountName,
+		))},
+		Caching:      compute.ReadWrite,
+		CreateOption: compute.Attach,
+	}}
+	virtualMachine.Properties.StorageProfile.DataDisks = &machine0DataDisks
+	assertRequestBody(c, s.requests[2], &virtualMachine)
+}
+
+func (s *storageSuite) TestAttachVolumesWithoutStorageProfile(c *gc.C) {
+	virtualMachine := compute.VirtualMachine{
+		Name:       to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{},
+	}
+	volumeSource := s.volumeSource(c)
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+	}
+
+	results, err := volumeSource.AttachVolumes([]storage.VolumeAttachmentParams{{
+		AttachmentParams: storage.AttachmentParams{
+			Provider:   "azure",
+			Machine:    names.NewMachineTag("0"),
+			InstanceId: "machine-0",
+		},
+		Volume:   names.NewVolumeTag("0"),
+		VolumeId: "volume-0",
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Error, gc.ErrorMatches, "instance machine-0 with no storage profile not valid")
+	c.Assert(results[0].Error, jc.Satisfies, errors.IsNotValid)
+	c.Assert(s.requests, gc.HasLen, 2) // no update
+}
+
+func (s *storageSuite) TestDetachVolumes(c *gc.C) {
+	// machine-0 has a three data disks: volume-0, volume-1 and volume-2
+	machine0DataDisks := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{
 			URI: to.StringPtr(fmt.Sprintf(
 				"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
 				storageAccountName,
@@ -564,18 +1664,29 @@ func (s *storageSuite) TestDetachVolumes(c *gc.C) {
 		},
 	}}
 
-	// There should be a one API calls to list VMs, and one update per modified instance.
-	virtualMachinesSender := azuretesting.NewSenderWithValue(compute.VirtualMachineListResult{
-		Value: &virtualMachines,
-	})
-	virtualMachinesSender.PathPattern = `.*/Microsoft\.Compute/virtualMachines`
+	// There should be one API call to get each VM, and one update per modified instance.
 	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
 	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	updatedMachine0DataDisks := []compute.DataDisk{
+		machine0DataDisks[0],
+		machine0DataDisks[2],
+	}
+	getVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile:    &compute.StorageProfile{DataDisks: &updatedMachine0DataDisks},
+			ProvisioningState: to.StringPtr("Succeeded"),
+		},
+	})
+	getVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
 	volumeSource := s.volumeSource(c)
 	s.sender = azuretesting.Senders{
-		virtualMachinesSender,
+		virtualMachineSender(virtualMachines[0], "etag-0"),
+		virtualMachineSender(virtualMachines[1], "etag-0"),
+		virtualMachineNotFoundSender("machine-42"),
 		s.accountSender(),
 		updateVirtualMachine0Sender,
+		getVirtualMachine0Sender,
 	}
 
 	results, err := volumeSource.DetachVolumes(params)
@@ -588,15 +1699,198 @@ func (s *storageSuite) TestDetachVolumes(c *gc.C) {
 	c.Check(results[3], gc.ErrorMatches, "instance machine-42 not found")
 
 	// Validate HTTP request bodies.
-	c.Assert(s.requests, gc.HasLen, 3)
-	c.Assert(s.requests[0].Method, gc.Equals, "GET") // list virtual machines
-	c.Assert(s.requests[1].Method, gc.Equals, "GET") // list storage accounts
-	c.Assert(s.requests[2].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests, gc.HasLen, 6)
+	for _, req := range s.requests[:3] {
+		c.Assert(req.Method, gc.Equals, "GET") // get virtual machines
+	}
+	c.Assert(s.requests[3].Method, gc.Equals, "GET") // list storage accounts
+	c.Assert(s.requests[4].Method, gc.Equals, "PUT") // update machine-0
+	c.Assert(s.requests[5].Method, gc.Equals, "GET") // confirm machine-0 update
 
 	machine0DataDisks = []compute.DataDisk{
 		machine0DataDisks[0],
 		machine0DataDisks[2],
 	}
 	virtualMachines[0].Properties.StorageProfile.DataDisks = &machine0DataDisks
-	assertRequestBody(c, s.requests[2], &virtualMachines[0])
+	assertRequestBody(c, s.requests[4], &virtualMachines[0])
+
+	// The volumes' VHDs are left alone by default.
+	s.storageClient.CheckNoCalls(c)
+}
+
+// detachVolumeSenders returns senders for detaching volume-0 from
+// machine-0, where the virtual machine subsequently has the given
+// data disks and provisioning state.
+func (s *storageSuite) detachVolumeSenders(dataDisks []compute.DataDisk, provisioningState string) azuretesting.Senders {
+	dataDiskURI := func(volumeId string) *string {
+		return to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/%s.vhd",
+			storageAccountName, volumeId,
+		))
+	}
+	attached := []compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("volume-0"),
+		Vhd:  &compute.VirtualHardDisk{URI: dataDiskURI("volume-0")},
+	}}
+	for i, disk := range dataDisks {
+		dataDisks[i].Vhd = &compute.VirtualHardDisk{URI: dataDiskURI(to.String(disk.Name))}
+	}
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{DataDisks: &attached},
+		},
+	}
+	updateVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{})
+	updateVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	getVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile:    &compute.StorageProfile{DataDisks: &dataDisks},
+			ProvisioningState: to.StringPtr(provisioningState),
+		},
+	})
+	getVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	return azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+		updateVirtualMachine0Sender,
+		getVirtualMachine0Sender,
+	}
+}
+
+func detachVolumeParams() []storage.VolumeAttachmentParams {
+	return []storage.VolumeAttachmentParams{{
+		AttachmentParams: storage.AttachmentParams{
+			Provider:   "azure",
+			Machine:    names.NewMachineTag("0"),
+			InstanceId: instance.Id("machine-0"),
+		},
+		Volume:   names.NewVolumeTag("0"),
+		VolumeId: "volume-0",
+	}}
+}
+
+func (s *storageSuite) TestDetachVolumesDestroyOnDetach(c *gc.C) {
+	volumeSource := s.volumeSource(c, testing.Attrs{"destroy-on-detach": true})
+	s.sender = s.detachVolumeSenders(nil, "Succeeded")
+	s.sender = append(s.sender, s.accountKeysSender())
+
+	results, err := volumeSource.DetachVolumes(detachVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0], jc.ErrorIsNil)
+	s.storageClient.CheckCallNames(c, "NewClient", "DeleteBlobIfExists")
+	s.storageClient.CheckCall(c, 1, "DeleteBlobIfExists", "datavhds", "volume-0.vhd")
+}
+
+func (s *storageSuite) TestDetachVolumesStillAttached(c *gc.C) {
+	volumeSource := s.volumeSource(c, testing.Attrs{"destroy-on-detach": true})
+	s.sender = s.detachVolumeSenders([]compute.DataDisk{{
+		Lun:  to.Int32Ptr(0),
+		Name: to.StringPtr("volume-0"),
+	}}, "Succeeded")
+
+	results, err := volumeSource.DetachVolumes(detachVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0], gc.ErrorMatches, `volume "volume-0" is still attached to instance machine-0`)
+	s.storageClient.CheckNoCalls(c)
+}
+
+func (s *storageSuite) TestDetachVolumesConfirmedWithoutStorageProfile(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = s.detachVolumeSenders(nil, "Succeeded")
+	// The re-read virtual machine has no storage profile at all.
+	getVirtualMachine0Sender := azuretesting.NewSenderWithValue(&compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			ProvisioningState: to.StringPtr("Succeeded"),
+		},
+	})
+	getVirtualMachine0Sender.PathPattern = `.*/Microsoft\.Compute/virtualMachines/machine-0`
+	s.sender[len(s.sender)-1] = getVirtualMachine0Sender
+
+	results, err := volumeSource.DetachVolumes(detachVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0], jc.ErrorIsNil)
+}
+
+func (s *storageSuite) TestDetachVolumesDestroyOnDetachNotAttached(c *gc.C) {
+	// volume-0 is not attached to machine-0, so there is
+	// nothing to detach, and its VHD must be left alone.
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{},
+		},
+	}
+	volumeSource := s.volumeSource(c, testing.Attrs{"destroy-on-detach": true})
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+	}
+
+	results, err := volumeSource.DetachVolumes(detachVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0], jc.ErrorIsNil)
+	c.Assert(s.requests, gc.HasLen, 2)
+	s.storageClient.CheckNoCalls(c)
+}
+
+func (s *storageSuite) TestDetachVolumesRefusesNonDataDisks(c *gc.C) {
+	// machine-0 has an OS disk named after the machine,
+	// and a disk named like a volume, but without a LUN.
+	dataDisks := []compute.DataDisk{{
+		Name: to.StringPtr("volume-0"),
+		Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+			"https://%s.blob.storage.azurestack.local/datavhds/volume-0.vhd",
+			storageAccountName,
+		))},
+	}}
+	virtualMachine := compute.VirtualMachine{
+		Name: to.StringPtr("machine-0"),
+		Properties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{
+				OsDisk: &compute.OSDisk{
+					Name: to.StringPtr("machine-0"),
+					Vhd: &compute.VirtualHardDisk{URI: to.StringPtr(fmt.Sprintf(
+						"https://%s.blob.storage.azurestack.local/osvhds/machine-0.vhd",
+						storageAccountName,
+					))},
+				},
+				DataDisks: &dataDisks,
+			},
+		},
+	}
+	volumeSource := s.volumeSource(c, testing.Attrs{"destroy-on-detach": true})
+	s.sender = azuretesting.Senders{
+		virtualMachineSender(virtualMachine, "etag-0"),
+		s.accountSender(),
+	}
+
+	params := append(detachVolumeParams(), detachVolumeParams()...)
+	params[1].VolumeId = "machine-0"
+	results, err := volumeSource.DetachVolumes(params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 2)
+	c.Assert(results[0], gc.ErrorMatches, `volume "volume-0" attached to instance machine-0 has no LUN, refusing to modify it`)
+	c.Assert(results[1], gc.ErrorMatches, `volume ID "machine-0" \(expected a data disk name\) not valid`)
+
+	// The virtual machine is not updated, and no VHDs are destroyed.
+	c.Assert(s.requests, gc.HasLen, 2)
+	s.storageClient.CheckNoCalls(c)
+}
+
+func (s *storageSuite) TestDetachVolumesUpdateFailed(c *gc.C) {
+	volumeSource := s.volumeSource(c)
+	s.sender = s.detachVolumeSenders(nil, "Failed")
+
+	results, err := volumeSource.DetachVolumes(detachVolumeParams())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0], gc.ErrorMatches, `updating instance machine-0: provisioning state is "Failed"`)
 }
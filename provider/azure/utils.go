@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
@@ -60,13 +61,28 @@ type callAPIFunc func(func() (autorest.Response, error)) error
 // be used as a callAPIFunc.
 type backoffAPIRequestCaller struct {
 	clock clock.Clock
+
+	// attempts is the maximum number of attempts to make. If
+	// attempts is zero, calls are retried until maxRetryDuration
+	// has elapsed.
+	attempts int
+
+	// jitter, if non-nil, is called with each computed delay
+	// and returns a duration to add to it.
+	jitter func(time.Duration) time.Duration
 }
 
 // call will call the supplied function, with exponential backoff
 // as long as the request returns an http.StatusTooManyRequests
-// status.
+// status. If the response carries a Retry-After header, the next
+// attempt will not be made before the requested time.
 func (c backoffAPIRequestCaller) call(f func() (autorest.Response, error)) error {
 	var resp *http.Response
+	attempts := c.attempts
+	if attempts == 0 {
+		attempts = -1
+	}
+	backoff := retryDelay
 	return retry.Call(retry.CallArgs{
 		Func: func() error {
 			autorestResp, err := f()
@@ -79,15 +95,53 @@ func (c backoffAPIRequestCaller) call(f func() (autorest.Response, error)) error
 		NotifyFunc: func(err error, attempt int) {
 			logger.Debugf("attempt %d: %v", attempt, err)
 		},
-		Attempts:    -1,
-		Delay:       retryDelay,
-		MaxDelay:    maxRetryDelay,
+		Attempts: attempts,
+		Delay:    retryDelay,
+		BackoffFunc: func(_ time.Duration, attempt int) time.Duration {
+			backoff = retry.DoubleDelay(backoff, attempt)
+			if backoff > maxRetryDelay {
+				backoff = maxRetryDelay
+			}
+			delay := backoff
+			if c.jitter != nil {
+				delay += c.jitter(delay)
+			}
+			if after := retryAfter(resp, c.clock.Now()); after > delay {
+				delay = after
+			}
+			return delay
+		},
 		MaxDuration: maxRetryDuration,
-		BackoffFunc: retry.DoubleDelay,
 		Clock:       c.clock,
 	})
 }
 
+// retryAfter returns the delay requested by the Retry-After header
+// in the given response, or zero if there is no such header.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now)
+	}
+	logger.Debugf("ignoring invalid Retry-After header %q", value)
+	return 0
+}
+
+// randomRetryJitter returns a random duration of up to a tenth
+// of the given delay.
+func randomRetryJitter(delay time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(delay/10) + 1))
+}
+
 // deleteResource deletes a resource with the given name from the resource
 // group, using the provided "Deleter". If the resource does not exist, an
 // error satisfying errors.IsNotFound will be returned.
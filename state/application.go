@@ -1604,12 +1604,11 @@ func (a *Application) StorageConstraints() (map[string]StorageConstraints, error
 // If no status is recorded, then there are no unit leaders and the
 // status is derived from the unit status values.
 func (a *Application) Status() (status.StatusInfo, error) {
-	statuses, closer := a.st.getCollection(statusesC)
-	defer closer()
-	query := statuses.Find(bson.D{{"_id", a.globalKey()}, {"neverset", true}})
-	if count, err := query.Count(); err != nil {
-		return status.StatusInfo{}, errors.Trace(err)
-	} else if count != 0 {
+	info, neverSet, err := getStatusWithNeverSet(a.st, a.globalKey(), "application")
+	if err != nil {
+		return status.StatusInfo{}, err
+	}
+	if neverSet {
 		// This indicates that SetStatus has never been called on this application.
 		// This in turn implies the application status document is likely to be
 		// inaccurate, so we return aggregated unit statuses instead.
@@ -1629,7 +1628,7 @@ func (a *Application) Status() (status.StatusInfo, error) {
 			return a.deriveStatus(units)
 		}
 	}
-	return getStatus(a.st, a.globalKey(), "application")
+	return info, nil
 }
 
 // SetStatus sets the status for the application.
@@ -1682,27 +1681,35 @@ func (a *Application) ApplicationAndUnitsStatus() (status.StatusInfo, map[string
 }
 
 func (a *Application) deriveStatus(units []*Unit) (status.StatusInfo, error) {
-	var result status.StatusInfo
-	for _, unit := range units {
-		currentSeverity := statusServerities[result.Status]
+	unitStatuses := make([]status.StatusInfo, len(units))
+	for i, unit := range units {
 		unitStatus, err := unit.Status()
 		if err != nil {
 			return status.StatusInfo{}, errors.Annotatef(err, "deriving application status from %q", unit.Name())
 		}
-		unitSeverity := statusServerities[unitStatus.Status]
-		if unitSeverity > currentSeverity {
-			result.Status = unitStatus.Status
-			result.Message = unitStatus.Message
-			result.Data = unitStatus.Data
-			result.Since = unitStatus.Since
+		unitStatuses[i] = unitStatus
+	}
+	return AggregateUnitStatuses(unitStatuses), nil
+}
+
+// AggregateUnitStatuses returns an application status derived from the
+// given unit statuses. The most severe status is chosen, in the order
+// error, blocked, waiting, maintenance, terminated, active and unknown;
+// where several units share that status, the first one wins. The zero
+// StatusInfo is returned if there are no statuses with a known severity.
+func AggregateUnitStatuses(unitStatuses []status.StatusInfo) status.StatusInfo {
+	var result status.StatusInfo
+	for _, unitStatus := range unitStatuses {
+		if statusSeverities[unitStatus.Status] > statusSeverities[result.Status] {
+			result = unitStatus
 		}
 	}
-	return result, nil
+	return result
 }
 
 // statusSeverities holds status values with a severity measure.
 // Status values with higher severity are used in preference to others.
-var statusServerities = map[status.Status]int{
+var statusSeverities = map[status.Status]int{
 	status.Error:       100,
 	status.Blocked:     90,
 	status.Waiting:     80,
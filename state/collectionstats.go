@@ -0,0 +1,93 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+)
+
+// CollectionStats holds usage statistics for a collection in the
+// state database.
+type CollectionStats struct {
+	// Name is the name of the collection.
+	Name string
+
+	// Global reports whether the collection's documents are shared by
+	// all models, rather than each belonging to a single model.
+	Global bool
+
+	// Count is the number of documents in the collection. For
+	// collections that are not global, only the documents belonging
+	// to the State's model are counted.
+	Count int
+
+	// Size is the size in bytes of the counted documents. For
+	// collections that are not global, this is estimated from the
+	// average size of all documents in the collection.
+	Size int64
+}
+
+// CollectionStats returns usage statistics for each collection in the
+// state database schema, ordered by name.
+func (st *State) CollectionStats() ([]CollectionStats, error) {
+	existing, err := st.MongoSession().DB(jujuDB).CollectionNames()
+	if err != nil {
+		return nil, errors.Annotate(err, "listing collections")
+	}
+	existingNames := set.NewStrings(existing...)
+
+	schema := st.database.Schema()
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make([]CollectionStats, len(names))
+	for i, name := range names {
+		stats[i] = CollectionStats{
+			Name:   name,
+			Global: schema[name].global,
+		}
+		if !existingNames.Contains(name) {
+			// Collections are created lazily.
+			continue
+		}
+		if err := st.collectionStats(&stats[i]); err != nil {
+			return nil, errors.Annotatef(err, "getting statistics for %q", name)
+		}
+	}
+	return stats, nil
+}
+
+// collectionStats fills in the Count and Size fields of the given
+// CollectionStats.
+func (st *State) collectionStats(stats *CollectionStats) error {
+	coll, closer := st.getCollection(stats.Name)
+	defer closer()
+	raw := coll.Writeable().Underlying()
+	size, err := getCollectionSize(raw)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	rawCount, err := raw.Count()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if stats.Global || rawCount == 0 {
+		stats.Count = rawCount
+		stats.Size = size
+		return nil
+	}
+	count, err := coll.Count()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stats.Count = count
+	stats.Size = int64(count) * (size / int64(rawCount))
+	return nil
+}
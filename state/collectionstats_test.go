@@ -0,0 +1,57 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/state"
+)
+
+type collectionStatsSuite struct {
+	ConnSuite
+}
+
+var _ = gc.Suite(&collectionStatsSuite{})
+
+func (s *collectionStatsSuite) statsByName(c *gc.C, st *state.State) map[string]state.CollectionStats {
+	stats, err := st.CollectionStats()
+	c.Assert(err, jc.ErrorIsNil)
+	byName := make(map[string]state.CollectionStats)
+	for i, stat := range stats {
+		if i > 0 {
+			c.Assert(stats[i-1].Name < stat.Name, jc.IsTrue)
+		}
+		byName[stat.Name] = stat
+	}
+	return byName
+}
+
+func (s *collectionStatsSuite) TestCollectionStats(c *gc.C) {
+	_, err := s.State.AddMachine("quantal", state.JobHostUnits)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.State.AddMachine("quantal", state.JobHostUnits)
+	c.Assert(err, jc.ErrorIsNil)
+
+	stats := s.statsByName(c, s.State)
+	machines := stats["machines"]
+	c.Assert(machines.Global, jc.IsFalse)
+	c.Assert(machines.Count, gc.Equals, 2)
+	c.Assert(machines.Size, jc.GreaterThan, int64(0))
+
+	controllers := stats["controllers"]
+	c.Assert(controllers.Global, jc.IsTrue)
+	c.Assert(controllers.Count, jc.GreaterThan, 0)
+}
+
+func (s *collectionStatsSuite) TestCollectionStatsFilteredByModel(c *gc.C) {
+	_, err := s.State.AddMachine("quantal", state.JobHostUnits)
+	c.Assert(err, jc.ErrorIsNil)
+
+	otherState := s.NewStateForModelNamed(c, "other")
+	stats := s.statsByName(c, otherState)
+	c.Assert(stats["machines"].Count, gc.Equals, 0)
+	c.Assert(stats["machines"].Size, gc.Equals, int64(0))
+}
@@ -5,6 +5,9 @@ package state
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/juju/errors"
 	jujutxn "github.com/juju/txn"
@@ -37,6 +40,14 @@ type Database interface {
 	// Same warnings apply for CopyForModel than for Copy.
 	CopyForModel(modelUUID string) (Database, SessionCloser)
 
+	// CopyWithTimeout returns a matching Database with its own session,
+	// as Copy does, but with the session's socket and sync timeouts set
+	// to the supplied duration, so that operations on it fail rather than
+	// block indefinitely when mongo is unresponsive.
+	//
+	// Same warnings apply for CopyWithTimeout than for Copy.
+	CopyWithTimeout(timeout time.Duration) (Database, SessionCloser)
+
 	// GetCollection returns the named Collection, and a func that must be
 	// called when the Collection is no longer needed. The returned Collection
 	// might or might not have its own session, depending on the Database; the
@@ -61,6 +72,52 @@ type Database interface {
 	// Schema returns the schema used to load the database. The returned schema
 	// is not a copy and must not be modified.
 	Schema() collectionSchema
+
+	// SessionStats reports how many sessions have been copied from the
+	// Database loaded by collectionSchema.Load, or any Database derived
+	// from it, and how many of those have not yet been closed. A steadily
+	// growing Outstanding count indicates that closers are not being called.
+	SessionStats() SessionStats
+}
+
+// SessionStats holds counts of the sessions copied by a Database.
+type SessionStats struct {
+
+	// Copied is the total number of sessions copied.
+	Copied int64
+
+	// Outstanding is the number of copied sessions whose closers have
+	// not yet been called.
+	Outstanding int64
+}
+
+// sessionCounter tracks the sessions copied by a family of databases.
+type sessionCounter struct {
+	copied      int64
+	outstanding int64
+}
+
+// track records a newly copied session, and returns a SessionCloser that
+// calls closer and records that the session has been closed. Calling the
+// returned SessionCloser more than once has no further effect on the counts.
+func (c *sessionCounter) track(closer SessionCloser) SessionCloser {
+	atomic.AddInt64(&c.copied, 1)
+	atomic.AddInt64(&c.outstanding, 1)
+	var once sync.Once
+	return func() {
+		closer()
+		once.Do(func() {
+			atomic.AddInt64(&c.outstanding, -1)
+		})
+	}
+}
+
+// stats returns the current counts.
+func (c *sessionCounter) stats() SessionStats {
+	return SessionStats{
+		Copied:      atomic.LoadInt64(&c.copied),
+		Outstanding: atomic.LoadInt64(&c.outstanding),
+	}
 }
 
 // Change represents any mgo/txn-representable change to a Database.
@@ -80,10 +137,35 @@ var ErrChangeComplete = errors.New("change complete")
 // Apply runs the supplied Change against the supplied Database. If it
 // returns no error, the change succeeded.
 func Apply(db Database, change Change) error {
+	return ApplyWithOptions(db, change, ApplyOptions{})
+}
+
+// ApplyOptions holds optional parameters for ApplyWithOptions.
+type ApplyOptions struct {
+
+	// MaxAttempts, if positive, limits the number of times the change
+	// will be prepared and run. If the limit is reached without the
+	// change succeeding, jujutxn.ErrExcessiveContention is returned.
+	MaxAttempts int
+
+	// ObserveAttempts, if non-nil, is called with the number of
+	// attempts made once the change has succeeded or failed. A high
+	// count indicates contention on the documents the change touches.
+	ObserveAttempts func(attempts int)
+}
+
+// ApplyWithOptions runs the supplied Change against the supplied
+// Database, as Apply does, according to the supplied options.
+func ApplyWithOptions(db Database, change Change, opts ApplyOptions) error {
 	db, closer := db.Copy()
 	defer closer()
 
-	buildTxn := func(int) ([]txn.Op, error) {
+	attempts := 0
+	buildTxn := func(attempt int) ([]txn.Op, error) {
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			return nil, jujutxn.ErrExcessiveContention
+		}
+		attempts = attempt + 1
 		ops, err := change.Prepare(db)
 		if errors.Cause(err) == ErrChangeComplete {
 			return nil, jujutxn.ErrNoOperations
@@ -96,7 +178,11 @@ func Apply(db Database, change Change) error {
 
 	runner, closer := db.TransactionRunner()
 	defer closer()
-	if err := runner.Run(buildTxn); err != nil {
+	err := runner.Run(buildTxn)
+	if opts.ObserveAttempts != nil {
+		opts.ObserveAttempts(attempts)
+	}
+	if err != nil {
 		return errors.Trace(err)
 	}
 	return nil
@@ -170,6 +256,7 @@ func (schema collectionSchema) Load(
 		schema:                 schema,
 		modelUUID:              modelUUID,
 		runTransactionObserver: runTransactionObserver,
+		sessions:               &sessionCounter{},
 	}, nil
 }
 
@@ -209,6 +296,10 @@ type database struct {
 	// runTransactionObserver is passed on to txn.TransactionRunner, to be
 	// invoked after calls to Run and RunTransaction.
 	runTransactionObserver RunTransactionObserverFunc
+
+	// sessions counts the sessions copied by this database and by every
+	// database copied from it.
+	sessions *sessionCounter
 }
 
 // RunTransactionObserverFunc is the type of a function to be called
@@ -223,7 +314,8 @@ func (db *database) copySession(modelUUID string) (*database, SessionCloser) {
 		modelUUID:  modelUUID,
 		runner:     db.runner,
 		ownSession: true,
-	}, session.Close
+		sessions:   db.sessions,
+	}, db.sessions.track(session.Close)
 }
 
 // Copy is part of the Database interface.
@@ -236,6 +328,14 @@ func (db *database) CopyForModel(modelUUID string) (Database, SessionCloser) {
 	return db.copySession(modelUUID)
 }
 
+// CopyWithTimeout is part of the Database interface.
+func (db *database) CopyWithTimeout(timeout time.Duration) (Database, SessionCloser) {
+	copied, closer := db.copySession(db.modelUUID)
+	copied.raw.Session.SetSocketTimeout(timeout)
+	copied.raw.Session.SetSyncTimeout(timeout)
+	return copied, closer
+}
+
 // GetCollection is part of the Database interface.
 func (db *database) GetCollection(name string) (collection mongo.Collection, closer SessionCloser) {
 	info, found := db.schema[name]
@@ -249,6 +349,7 @@ func (db *database) GetCollection(name string) (collection mongo.Collection, clo
 		closer = dontCloseAnything
 	} else {
 		collection, closer = mongo.CollectionFromName(db.raw, name)
+		closer = db.sessions.track(closer)
 	}
 
 	// Apply model filtering.
@@ -277,7 +378,7 @@ func (db *database) TransactionRunner() (runner jujutxn.Runner, closer SessionCl
 		if !db.ownSession {
 			session := raw.Session.Copy()
 			raw = raw.With(session)
-			closer = session.Close
+			closer = db.sessions.track(session.Close)
 		}
 		var observer func([]txn.Op, error)
 		if db.runTransactionObserver != nil {
@@ -305,3 +406,8 @@ func (db *database) TransactionRunner() (runner jujutxn.Runner, closer SessionCl
 func (db *database) Schema() collectionSchema {
 	return db.schema
 }
+
+// SessionStats is part of the Database interface.
+func (db *database) SessionStats() SessionStats {
+	return db.sessions.stats()
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	jujutxn "github.com/juju/txn"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/txn"
+)
+
+type databaseSuite struct {
+	internalStateSuite
+}
+
+var _ = gc.Suite(&databaseSuite{})
+
+// abortingChange is a Change whose transaction always aborts.
+type abortingChange struct {
+	prepared int
+}
+
+func (ch *abortingChange) Prepare(Database) ([]txn.Op, error) {
+	ch.prepared++
+	return []txn.Op{{
+		C:      constraintsC,
+		Id:     "no-such-constraints",
+		Assert: txn.DocExists,
+	}}, nil
+}
+
+type completeChange struct{}
+
+func (completeChange) Prepare(Database) ([]txn.Op, error) {
+	return nil, ErrChangeComplete
+}
+
+func (s *databaseSuite) TestApplyWithOptionsMaxAttempts(c *gc.C) {
+	var change abortingChange
+	var attempts int
+	err := ApplyWithOptions(s.state.database, &change, ApplyOptions{
+		MaxAttempts:     2,
+		ObserveAttempts: func(n int) { attempts = n },
+	})
+	c.Assert(errors.Cause(err), gc.Equals, jujutxn.ErrExcessiveContention)
+	c.Assert(change.prepared, gc.Equals, 2)
+	c.Assert(attempts, gc.Equals, 2)
+}
+
+func (s *databaseSuite) TestApplyWithOptionsObservesAttempts(c *gc.C) {
+	var attempts int
+	err := ApplyWithOptions(s.state.database, completeChange{}, ApplyOptions{
+		ObserveAttempts: func(n int) { attempts = n },
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(attempts, gc.Equals, 1)
+}
+
+func (s *databaseSuite) TestCopyWithTimeout(c *gc.C) {
+	db, closer := s.state.database.CopyWithTimeout(time.Minute)
+	defer closer()
+	c.Assert(db.(*database).raw.Session, gc.Not(gc.Equals), s.state.database.(*database).raw.Session)
+
+	machines, closer := db.GetCollection(machinesC)
+	defer closer()
+	_, err := machines.Count()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+// newCountingDatabase returns a database sharing the state's underlying
+// session but with its own session counter, so that sessions copied by
+// the state's background workers do not disturb the counts.
+func (s *databaseSuite) newCountingDatabase() Database {
+	db := s.state.database.(*database)
+	return &database{
+		raw:       db.raw,
+		schema:    db.schema,
+		modelUUID: db.modelUUID,
+		sessions:  &sessionCounter{},
+	}
+}
+
+func (s *databaseSuite) TestSessionStatsCopy(c *gc.C) {
+	root := s.newCountingDatabase()
+
+	db, closer := root.Copy()
+	stats := root.SessionStats()
+	c.Check(stats.Copied, gc.Equals, int64(1))
+	c.Check(stats.Outstanding, gc.Equals, int64(1))
+	c.Check(db.SessionStats(), gc.Equals, stats)
+
+	closer()
+	closer()
+	stats = root.SessionStats()
+	c.Check(stats.Copied, gc.Equals, int64(1))
+	c.Check(stats.Outstanding, gc.Equals, int64(0))
+}
+
+func (s *databaseSuite) TestSessionStatsCopyVariants(c *gc.C) {
+	root := s.newCountingDatabase()
+
+	_, closer1 := root.CopyForModel(s.state.ModelUUID())
+	_, closer2 := root.CopyWithTimeout(time.Minute)
+	stats := root.SessionStats()
+	c.Check(stats.Copied, gc.Equals, int64(2))
+	c.Check(stats.Outstanding, gc.Equals, int64(2))
+
+	closer1()
+	closer2()
+	stats = root.SessionStats()
+	c.Check(stats.Outstanding, gc.Equals, int64(0))
+}
+
+func (s *databaseSuite) TestSessionStatsCollectionsAndRunners(c *gc.C) {
+	root := s.newCountingDatabase()
+
+	_, closer1 := root.GetCollection(machinesC)
+	_, closer2 := root.TransactionRunner()
+	stats := root.SessionStats()
+	c.Check(stats.Copied, gc.Equals, int64(2))
+	c.Check(stats.Outstanding, gc.Equals, int64(2))
+	closer1()
+	closer2()
+	c.Check(root.SessionStats().Outstanding, gc.Equals, int64(0))
+
+	// Collections and runners from a copied database share its
+	// session, so they are not counted separately.
+	db, closer := root.Copy()
+	defer closer()
+	_, closer3 := db.GetCollection(machinesC)
+	defer closer3()
+	_, closer4 := db.TransactionRunner()
+	defer closer4()
+	stats = root.SessionStats()
+	c.Check(stats.Copied, gc.Equals, int64(3))
+	c.Check(stats.Outstanding, gc.Equals, int64(1))
+}
@@ -53,11 +53,13 @@ var (
 	ImageStorageNewStorage               = &imageStorageNewStorage
 	MachineIdLessThan                    = machineIdLessThan
 	ControllerAvailable                  = &controllerAvailable
+	StatusHistoryPollPeriod              = &statusHistoryPollPeriod
 	GetOrCreatePorts                     = getOrCreatePorts
 	GetPorts                             = getPorts
 	AddVolumeOps                         = (*State).addVolumeOps
 	CombineMeterStatus                   = combineMeterStatus
 	ApplicationGlobalKey                 = applicationGlobalKey
+	UnitGlobalKey                        = unitGlobalKey
 	ReadSettings                         = readSettings
 	ControllerInheritedSettingsGlobalKey = controllerInheritedSettingsGlobalKey
 	ModelGlobalKey                       = modelGlobalKey
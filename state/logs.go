@@ -783,17 +783,33 @@ func initLogsSession(st MongoSessioner) (*mgo.Session, *mgo.Collection) {
 }
 
 // getCollectionMB returns the size of a MongoDB collection (in
-// bytes), excluding space used by indexes.
+// megabytes), excluding space used by indexes.
 func getCollectionMB(coll *mgo.Collection) (int, error) {
+	size, err := getCollectionSize(coll)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return int(size / humanize.MiByte), nil
+}
+
+// getCollectionSize returns the total size, in bytes, of the documents
+// in the given collection, as reported by collStats. Index and storage
+// overheads are not included.
+func getCollectionSize(coll *mgo.Collection) (int64, error) {
 	var result bson.M
-	err := coll.Database.Run(bson.D{
-		{"collStats", coll.Name},
-		{"scale", humanize.MiByte},
-	}, &result)
+	err := coll.Database.Run(bson.D{{"collStats", coll.Name}}, &result)
 	if err != nil {
 		return 0, errors.Trace(err)
 	}
-	return result["size"].(int), nil
+	switch size := result["size"].(type) {
+	case int:
+		return int64(size), nil
+	case int64:
+		return size, nil
+	case float64:
+		return int64(size), nil
+	}
+	return 0, errors.Errorf("unexpected collection size %v", result["size"])
 }
 
 // getEnvsInLogs returns the unique model UUIDs that exist in
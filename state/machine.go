@@ -903,7 +903,15 @@ func (m *Machine) Remove() (err error) {
 		}
 		return ops, nil
 	}
-	return m.st.run(buildTxn)
+	if err := m.st.run(buildTxn); err != nil {
+		return err
+	}
+	for _, globalKey := range []string{m.globalKey(), m.globalInstanceKey()} {
+		if err := removeStatusHistory(m.st, globalKey); err != nil {
+			logger.Errorf("cannot delete history for machine %q: %v", m.Id(), err)
+		}
+	}
+	return nil
 }
 
 // Refresh refreshes the contents of the machine from the underlying
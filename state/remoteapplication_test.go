@@ -80,7 +80,6 @@ func (s *remoteApplicationSuite) TestInitialStatus(c *gc.C) {
 	c.Assert(appStatus, gc.DeepEquals, status.StatusInfo{
 		Status:  status.Unknown,
 		Message: "waiting for remote connection",
-		Data:    map[string]interface{}{},
 	})
 }
 
@@ -4,10 +4,17 @@
 package state
 
 import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/juju/errors"
 	jujutxn "github.com/juju/txn"
+	"golang.org/x/net/context"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/mgo.v2/txn"
@@ -49,7 +56,16 @@ func unixNanoToTime(i int64) *time.Time {
 // getStatus retrieves the status document associated with the given
 // globalKey and converts it to a StatusInfo. If the status document
 // is not found, a NotFoundError referencing badge will be returned.
-func getStatus(st *State, globalKey, badge string) (_ status.StatusInfo, err error) {
+func getStatus(st *State, globalKey, badge string) (status.StatusInfo, error) {
+	info, _, err := getStatusWithNeverSet(st, globalKey, badge)
+	return info, err
+}
+
+// getStatusWithNeverSet behaves like getStatus, but also reports whether
+// the status was created with NeverSet and has not been explicitly set
+// since. Callers that need to treat such placeholder statuses specially
+// should use this rather than inspecting the status document directly.
+func getStatusWithNeverSet(st *State, globalKey, badge string) (_ status.StatusInfo, neverSet bool, err error) {
 	defer errors.DeferredAnnotatef(&err, "cannot get status")
 	statuses, closer := st.getCollection(statusesC)
 	defer closer()
@@ -57,17 +73,107 @@ func getStatus(st *State, globalKey, badge string) (_ status.StatusInfo, err err
 	var doc statusDoc
 	err = statuses.FindId(globalKey).One(&doc)
 	if err == mgo.ErrNotFound {
-		return status.StatusInfo{}, errors.NotFoundf(badge)
+		return status.StatusInfo{}, false, errors.NotFoundf(badge)
 	} else if err != nil {
-		return status.StatusInfo{}, errors.Trace(err)
+		return status.StatusInfo{}, false, errors.Trace(err)
 	}
 
 	return status.StatusInfo{
 		Status:  doc.Status,
 		Message: doc.StatusInfo,
-		Data:    utils.UnescapeKeys(doc.StatusData),
+		Data:    unescapeStatusData(doc.StatusData),
 		Since:   unixNanoToTime(doc.Updated),
-	}, nil
+	}, doc.NeverSet, nil
+}
+
+// unescapeStatusData returns the given status data with its keys
+// unescaped. Most statuses carry no data, so nil is returned without
+// copying when there is nothing to unescape.
+func unescapeStatusData(data map[string]interface{}) map[string]interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return utils.UnescapeKeys(data)
+}
+
+// StatusKind identifies a kind of entity whose status is recorded
+// in state.
+type StatusKind string
+
+const (
+	// ApplicationStatusKind identifies application statuses.
+	ApplicationStatusKind StatusKind = "application"
+
+	// UnitStatusKind identifies unit workload statuses.
+	UnitStatusKind StatusKind = "unit"
+
+	// UnitAgentStatusKind identifies unit agent statuses.
+	UnitAgentStatusKind StatusKind = "unit-agent"
+
+	// MachineStatusKind identifies machine agent statuses.
+	MachineStatusKind StatusKind = "machine"
+
+	// MachineInstanceStatusKind identifies machine instance statuses.
+	MachineInstanceStatusKind StatusKind = "machine-instance"
+)
+
+// statusKindKeyPatterns holds, for each StatusKind, a regular
+// expression matching the global keys of statuses of that kind.
+var statusKindKeyPatterns = map[StatusKind]string{
+	ApplicationStatusKind:     `a#[^#]+`,
+	UnitStatusKind:            `u#[^#]+#charm`,
+	UnitAgentStatusKind:       `u#[^#]+`,
+	MachineStatusKind:         `m#[^#]+`,
+	MachineInstanceStatusKind: `m#[^#]+#instance`,
+}
+
+// AllStatuses returns the current statuses of all entities in the
+// model of the given kinds, keyed by the entities' global keys. All
+// of the statuses are read with a single query, which is much cheaper
+// than reading each entity's status in turn when reporting on the
+// whole model.
+//
+// Statuses are returned exactly as recorded: in particular, the
+// status of an application whose status has never been set is not
+// derived from its units' statuses.
+func (st *State) AllStatuses(kinds ...StatusKind) (_ map[string]status.StatusInfo, err error) {
+	defer errors.DeferredAnnotatef(&err, "cannot get statuses")
+	if len(kinds) == 0 {
+		return map[string]status.StatusInfo{}, nil
+	}
+	patterns := make([]string, len(kinds))
+	for i, kind := range kinds {
+		pattern, ok := statusKindKeyPatterns[kind]
+		if !ok {
+			return nil, errors.NotValidf("status kind %q", kind)
+		}
+		patterns[i] = pattern
+	}
+	keyRegex := fmt.Sprintf("^%s(?:%s)$",
+		regexp.QuoteMeta(st.docID("")), strings.Join(patterns, "|"),
+	)
+
+	statuses, closer := st.getCollection(statusesC)
+	defer closer()
+
+	var docs []struct {
+		Id        string `bson:"_id"`
+		statusDoc `bson:",inline"`
+	}
+	query := bson.D{{"_id", bson.D{{"$regex", keyRegex}}}}
+	if err := statuses.Find(query).All(&docs); err != nil {
+		return nil, errors.Trace(err)
+	}
+	result := make(map[string]status.StatusInfo, len(docs))
+	for _, doc := range docs {
+		result[st.localID(doc.Id)] = status.StatusInfo{
+			Status:  doc.Status,
+			Message: doc.StatusInfo,
+			Data:    unescapeStatusData(doc.StatusData),
+			Since:   unixNanoToTime(doc.Updated),
+		}
+	}
+	return result, nil
 }
 
 // setStatusParams configures a setStatus call. All parameters are presumed to
@@ -124,6 +230,65 @@ func setStatus(st *State, params setStatusParams) (err error) {
 	return errors.Trace(err)
 }
 
+// setStatusBatch sets the statuses described by the supplied params, as
+// documented on the type, in a single transaction: either every status is
+// updated, or none is. Each entity's status document is asserted on its
+// txn-revno; if the transaction aborts because some of those documents
+// changed concurrently, every txn-revno is read afresh and the transaction
+// is retried.
+func setStatusBatch(st *State, params []setStatusParams) (err error) {
+	defer errors.DeferredAnnotatef(&err, "cannot set statuses")
+	if len(params) == 0 {
+		return nil
+	}
+	docs := make([]statusDoc, len(params))
+	seen := make(map[string]bool)
+	for i, p := range params {
+		if seen[p.globalKey] {
+			return errors.NotValidf("duplicate status for %q", p.globalKey)
+		}
+		seen[p.globalKey] = true
+		docs[i] = statusDoc{
+			Status:     p.status,
+			StatusInfo: p.message,
+			StatusData: utils.EscapeKeys(p.rawData),
+			Updated:    p.updated.UnixNano(),
+		}
+	}
+	for i, p := range params {
+		probablyUpdateStatusHistory(st, p.globalKey, docs[i])
+	}
+
+	// Set the authoritative status documents, or fail trying.
+	buildTxn := func(int) ([]txn.Op, error) {
+		var ops []txn.Op
+		for _, p := range params {
+			if p.token == nil {
+				continue
+			}
+			if err := p.token.Check(&ops); err != nil {
+				return nil, errors.Annotatef(err, "prerequisites failed")
+			}
+		}
+		for i, p := range params {
+			txnRevno, err := st.readTxnRevno(statusesC, p.globalKey)
+			if errors.Cause(err) == mgo.ErrNotFound {
+				return nil, errors.NotFoundf(p.badge)
+			} else if err != nil {
+				return nil, errors.Trace(err)
+			}
+			ops = append(ops, txn.Op{
+				C:      statusesC,
+				Id:     p.globalKey,
+				Assert: bson.D{{"txn-revno", txnRevno}},
+				Update: bson.D{{"$set", &docs[i]}},
+			})
+		}
+		return ops, nil
+	}
+	return errors.Trace(st.run(buildTxn))
+}
+
 func statusSetOps(st *State, doc statusDoc, globalKey string) ([]txn.Op, error) {
 	update := bson.D{{"$set", &doc}}
 	txnRevno, err := st.readTxnRevno(statusesC, globalKey)
@@ -160,7 +325,23 @@ func removeStatusOp(st *State, globalKey string) txn.Op {
 	}
 }
 
+// removeStatusHistory removes all historical status documents associated
+// with the given globalKey. Status history is written outside of
+// transactions, so it cannot be removed with the entity's removal ops;
+// this should be called once the entity has been removed, so that its
+// history does not linger until it is pruned.
+func removeStatusHistory(st *State, globalKey string) error {
+	history, closer := st.getCollection(statusesHistoryC)
+	defer closer()
+	historyW := history.Writeable()
+	if _, err := historyW.RemoveAll(bson.D{{"globalkey", globalKey}}); err != nil {
+		return errors.Annotatef(err, "removing status history for %q", globalKey)
+	}
+	return nil
+}
+
 type historicalStatusDoc struct {
+	Id         bson.ObjectId          `bson:"_id,omitempty"`
 	ModelUUID  string                 `bson:"model-uuid"`
 	GlobalKey  string                 `bson:"globalkey"`
 	Status     status.Status          `bson:"status"`
@@ -260,11 +441,186 @@ func statusHistory(args *statusHistoryArgs) ([]status.StatusInfo, error) {
 	return results, nil
 }
 
+// StatusHistoryPage returns at most size status history entries, newest
+// first, for the entity with the given global key in the State's model.
+// If cursor is non-empty, the entries returned are those following the
+// entry it identifies. The returned cursor identifies the last entry
+// returned, and may be passed in to fetch the next page; it is empty if
+// there are no more entries.
+//
+// Unlike paging by date, entries that share an updated time are neither
+// skipped nor repeated.
+func (st *State) StatusHistoryPage(globalKey string, size int, cursor string) ([]status.StatusInfo, string, error) {
+	if size <= 0 {
+		return nil, "", errors.NotValidf("non-positive size")
+	}
+	query := bson.D{{"globalkey", globalKey}}
+	if cursor != "" {
+		updated, id, err := decodeStatusHistoryCursor(cursor)
+		if err != nil {
+			return nil, "", errors.Trace(err)
+		}
+		query = append(query, bson.DocElem{"$or", []bson.D{
+			{{"updated", bson.D{{"$lt", updated}}}},
+			{{"updated", updated}, {"_id", bson.D{{"$lt", id}}}},
+		}})
+	}
+	history, closer := st.getCollection(statusesHistoryC)
+	defer closer()
+
+	// Fetch one more entry than asked for, to know whether
+	// there is another page.
+	var docs []historicalStatusDoc
+	err := history.Find(query).Sort("-updated", "-_id").Limit(size + 1).All(&docs)
+	if err != nil {
+		return nil, "", errors.Annotate(err, "cannot get status history")
+	}
+	var next string
+	if len(docs) > size {
+		docs = docs[:size]
+		last := docs[len(docs)-1]
+		next = encodeStatusHistoryCursor(last.Updated, last.Id)
+	}
+	results := make([]status.StatusInfo, len(docs))
+	for i, doc := range docs {
+		results[i] = status.StatusInfo{
+			Status:  doc.Status,
+			Message: doc.StatusInfo,
+			Data:    utils.UnescapeKeys(doc.StatusData),
+			Since:   unixNanoToTime(doc.Updated),
+		}
+	}
+	return results, next, nil
+}
+
+// encodeStatusHistoryCursor returns an opaque cursor identifying the
+// status history entry with the given updated time and ID.
+func encodeStatusHistoryCursor(updated int64, id bson.ObjectId) string {
+	raw := fmt.Sprintf("%d:%s", updated, id.Hex())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeStatusHistoryCursor returns the updated time and ID of the
+// status history entry identified by the given cursor.
+func decodeStatusHistoryCursor(cursor string) (int64, bson.ObjectId, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", errors.NotValidf("cursor %q", cursor)
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || !bson.IsObjectIdHex(parts[1]) {
+		return 0, "", errors.NotValidf("cursor %q", cursor)
+	}
+	updated, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", errors.NotValidf("cursor %q", cursor)
+	}
+	return updated, bson.ObjectIdHex(parts[1]), nil
+}
+
+// StatusHistoryCount returns the number of status history entries
+// recorded for the entity with the given global key.
+func (st *State) StatusHistoryCount(globalKey string) (int, error) {
+	history, closer := st.getRawCollection(statusesHistoryC)
+	defer closer()
+	return countStatusHistory(history, bson.D{
+		{"model-uuid", st.ModelUUID()},
+		{"globalkey", globalKey},
+	})
+}
+
+// ModelStatusHistoryCount returns the number of status history entries
+// recorded for all of the entities in the model.
+func (st *State) ModelStatusHistoryCount() (int, error) {
+	history, closer := st.getRawCollection(statusesHistoryC)
+	defer closer()
+	return countStatusHistory(history, bson.D{{"model-uuid", st.ModelUUID()}})
+}
+
+// ModelStatusHistorySizeMB returns an estimate, in MiB, of the space
+// taken by the status history entries recorded for the model.
+//
+// The collection holding status history is shared by all models, and
+// mongo reports sizes only for whole collections, so the estimate is
+// the model's share, by count, of the collection's total data size.
+// It assumes that the model's entries are of average size: a model
+// whose entries carry unusually long messages or large data will be
+// under-estimated, and vice versa. The total excludes index and
+// storage overheads, and the counts and size are not read atomically,
+// so concurrent writes may skew the estimate slightly.
+func (st *State) ModelStatusHistorySizeMB() (float64, error) {
+	history, closer := st.getRawCollection(statusesHistoryC)
+	defer closer()
+	return estimateStatusHistoryMB(history, bson.D{{"model-uuid", st.ModelUUID()}})
+}
+
+// estimateStatusHistoryMB estimates the size, in MiB, of the status
+// history entries matching the given selector, as documented on
+// ModelStatusHistorySizeMB.
+func estimateStatusHistoryMB(history *mgo.Collection, selector bson.D) (float64, error) {
+	matching, err := countStatusHistory(history, selector)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if matching == 0 {
+		return 0, nil
+	}
+	total, err := countStatusHistory(history, nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	size, err := getCollectionSize(history)
+	if err != nil {
+		return 0, errors.Annotate(err, "retrieving status history collection size")
+	}
+	if total < matching {
+		// Entries were added between the two counts.
+		total = matching
+	}
+	return float64(size) * float64(matching) / float64(total) / humanize.MiByte, nil
+}
+
+// countStatusHistory returns the number of status history entries
+// matching the given selector. A nil selector counts all entries,
+// using the collection's own count rather than a query.
+func countStatusHistory(history *mgo.Collection, selector bson.D) (int, error) {
+	var count int
+	var err error
+	if selector == nil {
+		count, err = history.Count()
+	} else {
+		count, err = history.Find(selector).Count()
+	}
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Annotate(err, "counting status history records")
+	}
+	return count, nil
+}
+
 // PruneStatusHistory removes status history entries until
 // only logs newer than <maxLogTime> remain and also ensures
 // that the collection is smaller than <maxLogsMB> after the
 // deletion.
 func PruneStatusHistory(st *State, maxHistoryTime time.Duration, maxHistoryMB int) error {
+	return PruneStatusHistoryContext(context.Background(), st, maxHistoryTime, maxHistoryMB, 0)
+}
+
+// PruneStatusHistoryContext prunes status history as PruneStatusHistory
+// does, but stops between its removal passes if the supplied context is
+// cancelled, returning the context's error.
+//
+// If minKeepPerKey is positive, pruning to reduce the size of the
+// collection will not leave any entity with fewer than that many of
+// its most recent history entries. Pruning by age is unaffected.
+func PruneStatusHistoryContext(
+	ctx context.Context, st *State,
+	maxHistoryTime time.Duration, maxHistoryMB, minKeepPerKey int,
+) error {
+	if minKeepPerKey < 0 {
+		return errors.NotValidf("negative minKeepPerKey")
+	}
 	if maxHistoryMB < 0 {
 		return errors.NotValidf("non-positive maxHistoryMB")
 	}
@@ -279,6 +635,9 @@ func PruneStatusHistory(st *State, maxHistoryTime time.Duration, maxHistoryMB in
 
 	// Status Record Age
 	if maxHistoryTime > 0 {
+		if err := ctx.Err(); err != nil {
+			return errors.Trace(err)
+		}
 		t := st.clock.Now().Add(-maxHistoryTime)
 		_, err := history.RemoveAll(bson.D{
 			{"updated", bson.M{"$lt": t.UnixNano()}},
@@ -300,12 +659,12 @@ func PruneStatusHistory(st *State, maxHistoryTime time.Duration, maxHistoryMB in
 	}
 	// TODO(perrito666) explore if there would be any beneffit from having the
 	// size limit be per model
-	count, err := history.Count()
-	if err == mgo.ErrNotFound || count <= 0 {
-		return nil
-	}
+	count, err := countStatusHistory(history, nil)
 	if err != nil {
-		return errors.Annotate(err, "counting status history records")
+		return errors.Trace(err)
+	}
+	if count <= 0 {
+		return nil
 	}
 	// We are making the assumption that status sizes can be averaged for
 	// large numbers and we will get a reasonable approach on the size.
@@ -322,11 +681,73 @@ func PruneStatusHistory(st *State, maxHistoryTime time.Duration, maxHistoryMB in
 	if err != nil {
 		return errors.Trace(err)
 	}
-	_, err = history.RemoveAll(bson.D{
-		{"updated", bson.M{"$lt": result.Updated}},
-	})
+	if err := ctx.Err(); err != nil {
+		return errors.Trace(err)
+	}
+	selector := bson.D{{"updated", bson.M{"$lt": result.Updated}}}
+	if minKeepPerKey > 0 {
+		keepIds, err := statusHistoryIdsToKeep(history, result.Updated, minKeepPerKey)
+		if err != nil {
+			return errors.Annotate(err, "finding status history records to keep")
+		}
+		if len(keepIds) > 0 {
+			selector = append(selector, bson.DocElem{"_id", bson.M{"$nin": keepIds}})
+		}
+	}
+	_, err = history.RemoveAll(selector)
 	if err != nil {
 		return errors.Trace(err)
 	}
 	return nil
 }
+
+// statusHistoryIdsToKeep returns the IDs of the status history records,
+// updated before the given time, which must be kept so that no entity
+// is left with fewer than minKeepPerKey records.
+//
+// A single aggregation identifies the entities that would be left short,
+// so that only their records need be examined individually.
+func statusHistoryIdsToKeep(history *mgo.Collection, before int64, minKeepPerKey int) ([]bson.ObjectId, error) {
+	isOlder := bson.M{"$lt": []interface{}{"$updated", before}}
+	pipeline := []bson.M{{
+		"$group": bson.M{
+			"_id":   bson.M{"model-uuid": "$model-uuid", "globalkey": "$globalkey"},
+			"older": bson.M{"$sum": bson.M{"$cond": []interface{}{isOlder, 1, 0}}},
+			"newer": bson.M{"$sum": bson.M{"$cond": []interface{}{isOlder, 0, 1}}},
+		},
+	}, {
+		"$match": bson.M{
+			"older": bson.M{"$gt": 0},
+			"newer": bson.M{"$lt": minKeepPerKey},
+		},
+	}}
+	var shortKeys []struct {
+		Key struct {
+			ModelUUID string `bson:"model-uuid"`
+			GlobalKey string `bson:"globalkey"`
+		} `bson:"_id"`
+		Newer int `bson:"newer"`
+	}
+	if err := history.Pipe(pipeline).AllowDiskUse().All(&shortKeys); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var keepIds []bson.ObjectId
+	for _, key := range shortKeys {
+		var docs []struct {
+			Id bson.ObjectId `bson:"_id"`
+		}
+		err := history.Find(bson.D{
+			{"model-uuid", key.Key.ModelUUID},
+			{"globalkey", key.Key.GlobalKey},
+			{"updated", bson.M{"$lt": before}},
+		}).Sort("-updated").Limit(minKeepPerKey - key.Newer).Select(bson.M{"_id": 1}).All(&docs)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, doc := range docs {
+			keepIds = append(keepIds, doc.Id)
+		}
+	}
+	return keepIds, nil
+}
@@ -4,12 +4,15 @@
 package state_test
 
 import (
+	"fmt"
 	"regexp"
 	"time"
 
+	"github.com/juju/errors"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils/set"
+	"golang.org/x/net/context"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/juju/state"
@@ -52,6 +55,63 @@ func (s *StatusHistorySuite) TestPruneStatusHistoryBySize(c *gc.C) {
 	c.Assert(historyLen, jc.LessThan, 10000)
 }
 
+func (s *StatusHistorySuite) TestPruneStatusHistoryBySizeKeepsMinimumPerKey(c *gc.C) {
+	clock := testing.NewClock(coretesting.NonZeroTime())
+	err := s.State.SetClockForTesting(clock)
+	c.Assert(err, jc.ErrorIsNil)
+	service := s.Factory.MakeApplication(c, nil)
+	quiet := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	noisy := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	// The quiet unit's history is all older than the noisy unit's,
+	// so pruning by size alone would remove all of it.
+	state.PrimeUnitStatusHistory(c, clock, quiet, status.Active, 10, 10, nil)
+	state.PrimeUnitStatusHistory(c, clock, noisy, status.Active, 20000, 1000, nil)
+
+	err = state.PruneStatusHistoryContext(context.Background(), s.State, 0, 1, 5)
+	c.Assert(err, jc.ErrorIsNil)
+
+	history, err := quiet.StatusHistory(status.StatusHistoryFilter{Size: 25000})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 5)
+
+	history, err = noisy.StatusHistory(status.StatusHistoryFilter{Size: 25000})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(len(history), jc.LessThan, 10000)
+}
+
+func (s *StatusHistorySuite) TestPruneStatusHistoryNegativeMinKeepPerKey(c *gc.C) {
+	err := state.PruneStatusHistoryContext(context.Background(), s.State, time.Hour, 0, -1)
+	c.Assert(err, gc.ErrorMatches, "negative minKeepPerKey not valid")
+}
+
+func (s *StatusHistorySuite) TestModelStatusHistorySizeMB(c *gc.C) {
+	clock := testing.NewClock(coretesting.NonZeroTime())
+	otherSt := s.Factory.MakeModel(c, nil)
+	defer otherSt.Close()
+
+	unit := s.Factory.MakeUnit(c, nil)
+	otherUnit := factory.NewFactory(otherSt).MakeUnit(c, nil)
+	state.PrimeUnitStatusHistory(c, clock, unit, status.Active, 4000, 1000, nil)
+	state.PrimeUnitStatusHistory(c, clock, otherUnit, status.Active, 1000, 1000, nil)
+
+	size, err := s.State.ModelStatusHistorySizeMB()
+	c.Assert(err, jc.ErrorIsNil)
+	otherSize, err := otherSt.ModelStatusHistorySizeMB()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(size, jc.GreaterThan, 0.0)
+	c.Assert(otherSize, jc.GreaterThan, 0.0)
+
+	// The estimates are shares of the same total, by count.
+	count, err := s.State.ModelStatusHistoryCount()
+	c.Assert(err, jc.ErrorIsNil)
+	otherCount, err := otherSt.ModelStatusHistoryCount()
+	c.Assert(err, jc.ErrorIsNil)
+	ratio := size / otherSize
+	expected := float64(count) / float64(otherCount)
+	c.Assert(ratio, jc.GreaterThan, expected*0.999)
+	c.Assert(ratio, jc.LessThan, expected*1.001)
+}
+
 func (s *StatusHistorySuite) TestPruneStatusHistoryByDate(c *gc.C) {
 
 	// NOTE: the behaviour is bad, and the test is ugly. I'm just verifying
@@ -144,6 +204,21 @@ func (s *StatusHistorySuite) TestPruneStatusHistoryByDate(c *gc.C) {
 	}
 }
 
+func (s *StatusHistorySuite) TestPruneStatusHistoryContextCancelled(c *gc.C) {
+	service := s.Factory.MakeApplication(c, nil)
+	unit := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	primeUnitStatusHistory(c, unit, 10, 24*time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := state.PruneStatusHistoryContext(ctx, s.State, time.Hour, 0, 0)
+	c.Assert(errors.Cause(err), gc.Equals, context.Canceled)
+
+	history, err := unit.StatusHistory(status.StatusHistoryFilter{Size: 20})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 11)
+}
+
 func (s *StatusHistorySuite) TestStatusHistoryFilterRunningUpdateStatusHook(c *gc.C) {
 
 	service := s.Factory.MakeApplication(c, nil)
@@ -266,3 +341,144 @@ func (s *StatusHistorySuite) TestStatusHistoryFiltersByDateAndDelta(c *gc.C) {
 	c.Assert(history[1].Message, gc.Equals, "waiting for machine")
 	c.Assert(history[2].Message, gc.Equals, "2 days ago")
 }
+
+func (s *StatusHistorySuite) TestWatchStatusHistory(c *gc.C) {
+	s.PatchValue(state.StatusHistoryPollPeriod, 10*time.Millisecond)
+	service := s.Factory.MakeApplication(c, nil)
+	unit := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+
+	w := s.State.WatchStatusHistory(state.UnitGlobalKey(unit.Name()))
+	defer statetesting.AssertStop(c, w)
+	wc := statetesting.NewNotifyWatcherC(c, s.State, w)
+	wc.AssertOneChange()
+
+	now := time.Now()
+	err := unit.SetStatus(status.StatusInfo{
+		Status:  status.Active,
+		Message: "recorded",
+		Since:   &now,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	wc.AssertOneChange()
+
+	// Status changes to other entities are not reported.
+	other := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	err = other.SetStatus(status.StatusInfo{
+		Status:  status.Active,
+		Message: "elsewhere",
+		Since:   &now,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	wc.AssertNoChange()
+}
+
+func (s *StatusHistorySuite) TestUnitRemovalRemovesStatusHistory(c *gc.C) {
+	service := s.Factory.MakeApplication(c, nil)
+	unit := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	primeUnitStatusHistory(c, unit, 5, 0)
+
+	err := unit.Destroy()
+	c.Assert(err, jc.ErrorIsNil)
+	err = unit.Refresh()
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	history, err := unit.StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 0)
+	history, err = unit.Agent().StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 0)
+}
+
+func (s *StatusHistorySuite) TestDyingUnitRemovalRemovesStatusHistory(c *gc.C) {
+	service := s.Factory.MakeApplication(c, nil)
+	unit := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	preventUnitDestroyRemove(c, unit)
+
+	// Destroying an assigned unit with a running agent leaves
+	// it Dying, and its status history must be kept until the
+	// unit is removed.
+	err := unit.Destroy()
+	c.Assert(err, jc.ErrorIsNil)
+	assertLife(c, unit, state.Dying)
+	primeUnitStatusHistory(c, unit, 5, 0)
+	history, err := unit.StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.Not(gc.HasLen), 0)
+
+	err = unit.EnsureDead()
+	c.Assert(err, jc.ErrorIsNil)
+	err = unit.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+
+	history, err = unit.StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 0)
+	history, err = unit.Agent().StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 0)
+}
+
+func (s *StatusHistorySuite) TestMachineRemovalRemovesStatusHistory(c *gc.C) {
+	machine := s.Factory.MakeMachine(c, nil)
+	primeStatusHistory(c, machine, status.Started, 5, func(int) map[string]interface{} {
+		return nil
+	}, 0, "")
+	history, err := machine.StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.Not(gc.HasLen), 0)
+
+	err = machine.EnsureDead()
+	c.Assert(err, jc.ErrorIsNil)
+	err = machine.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+
+	history, err = machine.StatusHistory(status.StatusHistoryFilter{Size: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 0)
+}
+
+func (s *StatusHistorySuite) TestStatusHistoryPage(c *gc.C) {
+	service := s.Factory.MakeApplication(c, nil)
+	unit := s.Factory.MakeUnit(c, &factory.UnitParams{Application: service})
+	globalKey := state.UnitGlobalKey(unit.Name())
+
+	// All entries share the same updated time, so paging by
+	// date could not tell them apart.
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		err := unit.SetStatus(status.StatusInfo{
+			Status:  status.Active,
+			Message: fmt.Sprintf("status %d", i),
+			Since:   &now,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	all, cursor, err := s.State.StatusHistoryPage(globalKey, 100, "")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cursor, gc.Equals, "")
+	c.Assert(len(all), jc.GreaterThan, 5)
+	for i, info := range all[:5] {
+		c.Check(info.Message, gc.Equals, fmt.Sprintf("status %d", 4-i))
+	}
+
+	var paged []status.StatusInfo
+	for {
+		page, next, err := s.State.StatusHistoryPage(globalKey, 2, cursor)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(len(page), jc.LessThan, 3)
+		paged = append(paged, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	c.Assert(paged, jc.DeepEquals, all)
+}
+
+func (s *StatusHistorySuite) TestStatusHistoryPageInvalid(c *gc.C) {
+	_, _, err := s.State.StatusHistoryPage("u#foo/0#charm", 0, "")
+	c.Assert(err, gc.ErrorMatches, "non-positive size not valid")
+	_, _, err = s.State.StatusHistoryPage("u#foo/0#charm", 10, "bogus")
+	c.Assert(err, gc.ErrorMatches, `cursor "bogus" not valid`)
+}
@@ -0,0 +1,290 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/juju/juju/status"
+)
+
+type statusInternalSuite struct {
+	internalStateSuite
+}
+
+var _ = gc.Suite(&statusInternalSuite{})
+
+func (s *statusInternalSuite) addMachines(c *gc.C, n int) []*Machine {
+	machines := make([]*Machine, n)
+	for i := range machines {
+		m, err := s.state.AddMachine("quantal", JobHostUnits)
+		c.Assert(err, jc.ErrorIsNil)
+		machines[i] = m
+	}
+	return machines
+}
+
+func (s *statusInternalSuite) batchParams(machines []*Machine, message string) []setStatusParams {
+	now := time.Now()
+	params := make([]setStatusParams, len(machines))
+	for i, m := range machines {
+		params[i] = setStatusParams{
+			badge:     "machine",
+			globalKey: m.globalKey(),
+			status:    status.Stopped,
+			message:   message,
+			updated:   &now,
+		}
+	}
+	return params
+}
+
+func (s *statusInternalSuite) TestSetStatusBatch(c *gc.C) {
+	machines := s.addMachines(c, 3)
+	err := setStatusBatch(s.state, s.batchParams(machines, "bye"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	for _, m := range machines {
+		statusInfo, err := m.Status()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(statusInfo.Status, gc.Equals, status.Stopped)
+		c.Check(statusInfo.Message, gc.Equals, "bye")
+
+		history, err := m.StatusHistory(status.StatusHistoryFilter{Size: 1})
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(history, gc.HasLen, 1)
+		c.Check(history[0].Message, gc.Equals, "bye")
+	}
+}
+
+func (s *statusInternalSuite) TestSetStatusBatchRetriesChanged(c *gc.C) {
+	machines := s.addMachines(c, 2)
+	defer SetBeforeHooks(c, s.state, func() {
+		now := time.Now()
+		err := machines[1].SetStatus(status.StatusInfo{
+			Status:  status.Started,
+			Message: "concurrent",
+			Since:   &now,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}).Check()
+
+	err := setStatusBatch(s.state, s.batchParams(machines, "bye"))
+	c.Assert(err, jc.ErrorIsNil)
+	for _, m := range machines {
+		statusInfo, err := m.Status()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(statusInfo.Message, gc.Equals, "bye")
+	}
+}
+
+func (s *statusInternalSuite) TestSetStatusBatchDuplicate(c *gc.C) {
+	machines := s.addMachines(c, 1)
+	params := s.batchParams(machines, "bye")
+	err := setStatusBatch(s.state, append(params, params[0]))
+	c.Assert(err, gc.ErrorMatches, `cannot set statuses: duplicate status for "m#0" not valid`)
+}
+
+func (s *statusInternalSuite) TestSetStatusBatchNotFound(c *gc.C) {
+	machines := s.addMachines(c, 1)
+	now := time.Now()
+	params := append(s.batchParams(machines, "bye"), setStatusParams{
+		badge:     "machine",
+		globalKey: "m#42",
+		status:    status.Stopped,
+		updated:   &now,
+	})
+	err := setStatusBatch(s.state, params)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	statusInfo, err := machines[0].Status()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(statusInfo.Message, gc.Not(gc.Equals), "bye")
+}
+
+func (s *statusInternalSuite) TestGetStatusWithNeverSet(c *gc.C) {
+	ch := AddTestingCharm(c, s.state, "dummy")
+	app := AddTestingService(c, s.state, "dummy", ch)
+
+	info, neverSet, err := getStatusWithNeverSet(s.state, app.globalKey(), "application")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(neverSet, jc.IsTrue)
+	c.Check(info.Status, gc.Equals, status.Waiting)
+
+	now := time.Now()
+	err = app.SetStatus(status.StatusInfo{
+		Status:  status.Active,
+		Message: "ready",
+		Since:   &now,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	info, neverSet, err = getStatusWithNeverSet(s.state, app.globalKey(), "application")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(neverSet, jc.IsFalse)
+	c.Check(info.Message, gc.Equals, "ready")
+}
+
+func (s *statusInternalSuite) TestGetStatusWithNeverSetNotFound(c *gc.C) {
+	_, _, err := getStatusWithNeverSet(s.state, "a#missing", "application")
+	c.Assert(err, gc.ErrorMatches, "cannot get status: application not found")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *statusInternalSuite) TestGetStatusEmptyData(c *gc.C) {
+	machine := s.addMachines(c, 1)[0]
+	info, err := getStatus(s.state, machine.globalKey(), "machine")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Data, gc.IsNil)
+}
+
+func (s *statusInternalSuite) TestGetStatusEscapedData(c *gc.C) {
+	machine := s.addMachines(c, 1)[0]
+	now := time.Now()
+	data := map[string]interface{}{
+		"$foo": "bar",
+		"a.b":  map[string]interface{}{"c.d": 1},
+	}
+	err := machine.SetStatus(status.StatusInfo{
+		Status: status.Started,
+		Data:   data,
+		Since:  &now,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	info, err := getStatus(s.state, machine.globalKey(), "machine")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Data, jc.DeepEquals, data)
+}
+
+func (s *statusInternalSuite) TestAllStatuses(c *gc.C) {
+	ch := AddTestingCharm(c, s.state, "dummy")
+	app := AddTestingService(c, s.state, "dummy", ch)
+	unit, err := app.AddUnit()
+	c.Assert(err, jc.ErrorIsNil)
+	machine := s.addMachines(c, 1)[0]
+
+	now := time.Now()
+	err = unit.SetStatus(status.StatusInfo{
+		Status:  status.Active,
+		Message: "working",
+		Since:   &now,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	statuses, err := s.state.AllStatuses(ApplicationStatusKind, UnitStatusKind)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(statuses, gc.HasLen, 2)
+	c.Check(statuses[app.globalKey()].Status, gc.Equals, status.Waiting)
+	c.Check(statuses[unit.globalKey()].Status, gc.Equals, status.Active)
+	c.Check(statuses[unit.globalKey()].Message, gc.Equals, "working")
+
+	statuses, err = s.state.AllStatuses(UnitAgentStatusKind, MachineStatusKind)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(statuses, gc.HasLen, 2)
+	for _, key := range []string{unit.globalAgentKey(), machine.globalKey()} {
+		_, ok := statuses[key]
+		c.Check(ok, jc.IsTrue, gc.Commentf("%s", key))
+	}
+
+	statuses, err = s.state.AllStatuses(MachineInstanceStatusKind)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(statuses, gc.HasLen, 1)
+	_, ok := statuses[machine.globalInstanceKey()]
+	c.Check(ok, jc.IsTrue)
+}
+
+func (s *statusInternalSuite) TestAllStatusesMatchesGetStatus(c *gc.C) {
+	machine := s.addMachines(c, 1)[0]
+	now := time.Now()
+	err := machine.SetStatus(status.StatusInfo{
+		Status: status.Started,
+		Data:   map[string]interface{}{"a.b": 1},
+		Since:  &now,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	expected, err := getStatus(s.state, machine.globalKey(), "machine")
+	c.Assert(err, jc.ErrorIsNil)
+	statuses, err := s.state.AllStatuses(MachineStatusKind)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(statuses, jc.DeepEquals, map[string]status.StatusInfo{
+		machine.globalKey(): expected,
+	})
+}
+
+func (s *statusInternalSuite) TestAllStatusesNoKinds(c *gc.C) {
+	s.addMachines(c, 1)
+	statuses, err := s.state.AllStatuses()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(statuses, gc.HasLen, 0)
+}
+
+func (s *statusInternalSuite) TestAllStatusesInvalidKind(c *gc.C) {
+	_, err := s.state.AllStatuses("bogus")
+	c.Assert(err, gc.ErrorMatches, `cannot get statuses: status kind "bogus" not valid`)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *statusInternalSuite) TestStatusHistoryCount(c *gc.C) {
+	machines := s.addMachines(c, 2)
+	initial, err := s.state.StatusHistoryCount(machines[0].globalKey())
+	c.Assert(err, jc.ErrorIsNil)
+	modelInitial, err := s.state.ModelStatusHistoryCount()
+	c.Assert(err, jc.ErrorIsNil)
+
+	for i := 0; i < 3; i++ {
+		err := setStatusBatch(s.state, s.batchParams(machines, fmt.Sprintf("message %d", i)))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	count, err := s.state.StatusHistoryCount(machines[0].globalKey())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, initial+3)
+	modelCount, err := s.state.ModelStatusHistoryCount()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(modelCount, gc.Equals, modelInitial+6)
+}
+
+func (s *statusInternalSuite) TestStatusHistoryCountUnknownKey(c *gc.C) {
+	count, err := s.state.StatusHistoryCount("m#42")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 0)
+}
+
+func (s *statusInternalSuite) TestEstimateStatusHistoryMBNoMatches(c *gc.C) {
+	history, closer := s.state.getRawCollection(statusesHistoryC)
+	defer closer()
+	size, err := estimateStatusHistoryMB(history, bson.D{{"model-uuid", "no-such-model"}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(size, gc.Equals, 0.0)
+}
+
+func (s *statusInternalSuite) BenchmarkUnescapeStatusDataEmpty(c *gc.C) {
+	var data map[string]interface{}
+	for i := 0; i < c.N; i++ {
+		unescapeStatusData(data)
+	}
+}
+
+func (s *statusInternalSuite) BenchmarkUnescapeKeysEmpty(c *gc.C) {
+	var data map[string]interface{}
+	for i := 0; i < c.N; i++ {
+		utils.UnescapeKeys(data)
+	}
+}
+
+func (s *statusInternalSuite) BenchmarkUnescapeStatusData(c *gc.C) {
+	data := utils.EscapeKeys(map[string]interface{}{"$foo": "bar", "a.b": 1})
+	for i := 0; i < c.N; i++ {
+		unescapeStatusData(data)
+	}
+}
@@ -240,3 +240,48 @@ func (s *ServiceStatusSuite) TestServiceStatusOverridesDerivedStatus(c *gc.C) {
 	c.Check(err, jc.ErrorIsNil)
 	c.Check(info.Status, gc.Equals, status.Maintenance)
 }
+
+func (s *ServiceStatusSuite) TestAggregateUnitStatuses(c *gc.C) {
+	info := func(st status.Status, message string) status.StatusInfo {
+		return status.StatusInfo{Status: st, Message: message}
+	}
+	for i, test := range []struct {
+		statuses []status.StatusInfo
+		expected status.StatusInfo
+	}{{
+		expected: status.StatusInfo{},
+	}, {
+		statuses: []status.StatusInfo{info(status.Active, "a")},
+		expected: info(status.Active, "a"),
+	}, {
+		statuses: []status.StatusInfo{
+			info(status.Active, "a"),
+			info(status.Maintenance, "m"),
+			info(status.Waiting, "w"),
+		},
+		expected: info(status.Waiting, "w"),
+	}, {
+		statuses: []status.StatusInfo{
+			info(status.Waiting, "w"),
+			info(status.Error, "e"),
+			info(status.Blocked, "b"),
+		},
+		expected: info(status.Error, "e"),
+	}, {
+		statuses: []status.StatusInfo{
+			info(status.Blocked, "first"),
+			info(status.Blocked, "second"),
+		},
+		expected: info(status.Blocked, "first"),
+	}, {
+		statuses: []status.StatusInfo{
+			info(status.Unknown, "u"),
+			info(status.Terminated, "t"),
+			info(status.Active, "a"),
+		},
+		expected: info(status.Terminated, "t"),
+	}} {
+		c.Logf("test %d", i)
+		c.Check(state.AggregateUnitStatuses(test.statuses), jc.DeepEquals, test.expected)
+	}
+}
@@ -335,28 +335,25 @@ func (u *Unit) Destroy() (err error) {
 		return nil, jujutxn.ErrNoOperations
 	}
 	if err = unit.st.run(buildTxn); err == nil {
-		if historyErr := unit.eraseHistory(); historyErr != nil {
-			logger.Errorf("cannot delete history for unit %q: %v", unit.globalKey(), err)
-		}
 		if err = unit.Refresh(); errors.IsNotFound(err) {
+			// The unit was removed outright, rather than
+			// becoming Dying, so Remove will not be called.
+			unit.eraseHistory()
 			return nil
 		}
 	}
 	return err
 }
 
-func (u *Unit) eraseHistory() error {
-	history, closer := u.st.getCollection(statusesHistoryC)
-	defer closer()
-	historyW := history.Writeable()
-
-	if _, err := historyW.RemoveAll(bson.D{{"statusid", u.globalKey()}}); err != nil {
-		return err
-	}
-	if _, err := historyW.RemoveAll(bson.D{{"statusid", u.globalAgentKey()}}); err != nil {
-		return err
+// eraseHistory removes the status history of the unit and its agent.
+// It must only be called once the unit has been removed. Failures are
+// logged rather than returned, as the unit is already gone.
+func (u *Unit) eraseHistory() {
+	for _, globalKey := range []string{u.globalKey(), u.globalAgentKey()} {
+		if err := removeStatusHistory(u.st, globalKey); err != nil {
+			logger.Errorf("cannot delete history for unit %q: %v", u.Name(), err)
+		}
 	}
-	return nil
 }
 
 // destroyOps returns the operations required to destroy the unit. If it
@@ -668,7 +665,11 @@ func (u *Unit) Remove() (err error) {
 		}
 		return nil, jujutxn.ErrNoOperations
 	}
-	return unit.st.run(buildTxn)
+	if err := unit.st.run(buildTxn); err != nil {
+		return err
+	}
+	unit.eraseHistory()
+	return nil
 }
 
 // Resolved returns the resolved mode for the unit.
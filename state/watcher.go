@@ -2204,6 +2204,95 @@ func (st *State) WatchControllerStatusChanges() StringsWatcher {
 	})
 }
 
+// WatchStatusHistory returns a NotifyWatcher that notifies when a new
+// status history entry is recorded for the entity with the given global
+// key in the State's model.
+//
+// Status history documents are written outside of transactions, so they
+// are never seen by the transaction log watcher; instead, the status
+// history collection is polled for the entity's newest entry.
+func (st *State) WatchStatusHistory(globalKey string) NotifyWatcher {
+	return newStatusHistoryWatcher(st, globalKey)
+}
+
+// statusHistoryPollPeriod is the delay between each query made by a
+// statusHistoryWatcher for new status history entries.
+var statusHistoryPollPeriod = watcher.Period
+
+// statusHistoryWatcher notifies when new entries are added to the
+// status history of a single entity.
+type statusHistoryWatcher struct {
+	commonWatcher
+	globalKey string
+	out       chan struct{}
+}
+
+var _ NotifyWatcher = (*statusHistoryWatcher)(nil)
+
+func newStatusHistoryWatcher(st *State, globalKey string) NotifyWatcher {
+	w := &statusHistoryWatcher{
+		commonWatcher: newCommonWatcher(st),
+		globalKey:     globalKey,
+		out:           make(chan struct{}),
+	}
+	go func() {
+		defer w.tomb.Done()
+		defer close(w.out)
+		w.tomb.Kill(w.loop())
+	}()
+	return w
+}
+
+// Changes returns the event channel for the statusHistoryWatcher.
+func (w *statusHistoryWatcher) Changes() <-chan struct{} {
+	return w.out
+}
+
+// latest returns the ID of the newest status history entry for the
+// watched entity, or the empty ID if it has none.
+func (w *statusHistoryWatcher) latest() (bson.ObjectId, error) {
+	history, closer := w.st.getCollection(statusesHistoryC)
+	defer closer()
+	var doc struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	err := history.Find(bson.D{{"globalkey", w.globalKey}}).
+		Select(bson.D{{"_id", 1}}).Sort("-_id").One(&doc)
+	if err == mgo.ErrNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Annotatef(err, "cannot read status history for %q", w.globalKey)
+	}
+	return doc.Id, nil
+}
+
+func (w *statusHistoryWatcher) loop() error {
+	latest, err := w.latest()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	out := w.out
+	for {
+		select {
+		case <-w.tomb.Dying():
+			return tomb.ErrDying
+		case <-w.watcher.Dead():
+			return stateWatcherDeadError(w.watcher.Err())
+		case <-time.After(statusHistoryPollPeriod):
+			id, err := w.latest()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if id != latest {
+				latest = id
+				out = w.out
+			}
+		case out <- struct{}{}:
+			out = nil
+		}
+	}
+}
+
 func makeControllerIdFilter(st *State) func(interface{}) bool {
 	initialInfo, err := st.ControllerInfo()
 	if err != nil {
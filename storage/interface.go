@@ -127,6 +127,41 @@ type VolumeSource interface {
 	DetachVolumes(params []VolumeAttachmentParams) ([]error, error)
 }
 
+// VolumeImporter provides an interface for bringing volumes that
+// were not created by Juju under Juju's management.
+type VolumeImporter interface {
+	// ImportVolume adopts the volume with the specified provider
+	// volume ID, tagging it with the given resource tags, and
+	// returns its properties. The volume's contents are left
+	// untouched.
+	//
+	// The returned VolumeInfo holds the ID by which the provider
+	// will know the volume from then on, which need not be the
+	// one given; for example, the Azure provider takes the URI of
+	// a VHD blob, and identifies the imported volume by its
+	// container and blob name. Volumes that are already managed
+	// by Juju are rejected.
+	ImportVolume(volumeId string, resourceTags map[string]string) (VolumeInfo, error)
+}
+
+// CreateVolumesObserver is called by an ObservingVolumeCreator as each
+// volume in a batch is completed, with the index of the volume's
+// parameters and the volume's result.
+type CreateVolumesObserver func(index int, result CreateVolumesResult)
+
+// ObservingVolumeCreator provides an interface for creating volumes,
+// reporting the outcome for each volume as soon as it is known rather
+// than only once the whole batch is complete.
+type ObservingVolumeCreator interface {
+	// CreateVolumesWithObserver creates volumes as CreateVolumes does,
+	// additionally calling observe once for each of the parameters as
+	// the corresponding volume is completed, whether successfully or
+	// not. If an error is returned, observe may not have been called
+	// for every volume. The results returned are the same as those
+	// that CreateVolumes would return.
+	CreateVolumesWithObserver(params []VolumeParams, observe CreateVolumesObserver) ([]CreateVolumesResult, error)
+}
+
 // FilesystemSource provides an interface for creating, destroying and
 // describing filesystems in the environment. A FilesystemSource is
 // configured in a particular way, and corresponds to a storage "pool".